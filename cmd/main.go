@@ -5,6 +5,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"net"
 	"net/http"
@@ -15,12 +16,20 @@ import (
 	"time"
 
 	"github.com/vadimbarashkov/medods-test-task/internal/config"
+	"github.com/vadimbarashkov/medods-test-task/internal/repository"
+	"github.com/vadimbarashkov/medods-test-task/internal/repository/maxmind"
+	"github.com/vadimbarashkov/medods-test-task/internal/repository/memory"
+	"github.com/vadimbarashkov/medods-test-task/internal/repository/userservice"
 	"github.com/vadimbarashkov/medods-test-task/internal/service"
+	"github.com/vadimbarashkov/medods-test-task/internal/signing"
+	"github.com/vadimbarashkov/medods-test-task/pkg/clientip"
 	"github.com/vadimbarashkov/medods-test-task/pkg/notifier"
 	"github.com/vadimbarashkov/medods-test-task/pkg/postgres"
+	"github.com/vadimbarashkov/medods-test-task/templates"
 
 	api "github.com/vadimbarashkov/medods-test-task/internal/http"
-	repository "github.com/vadimbarashkov/medods-test-task/internal/repository/postgres"
+	v1 "github.com/vadimbarashkov/medods-test-task/internal/http/handler/v1"
+	postgresrepo "github.com/vadimbarashkov/medods-test-task/internal/repository/postgres"
 )
 
 var configPath string
@@ -44,6 +53,135 @@ func setupLogger(env string) {
 	slog.SetDefault(logger)
 }
 
+func loadSigningKeys(cfg []config.SigningKey) ([]*signing.Key, error) {
+	keys := make([]*signing.Key, 0, len(cfg))
+	for _, c := range cfg {
+		var key *signing.Key
+		if c.Algorithm == signing.AlgHS512 {
+			key = signing.NewHMACKey(c.ID, []byte(c.Secret))
+		} else {
+			var err error
+			if key, err = signing.LoadKey(c.ID, c.Algorithm, c.PrivateKeyPath); err != nil {
+				return nil, fmt.Errorf("load key %q: %w", c.ID, err)
+			}
+		}
+		key.RetireAt = c.RetireAt
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func replaceKeyrings(cfg config.Tokens, accessKeyring, refreshKeyring *signing.Keyring) error {
+	accessKeys, err := loadSigningKeys(cfg.AccessKeys)
+	if err != nil {
+		return fmt.Errorf("load access keys: %w", err)
+	}
+	refreshKeys, err := loadSigningKeys(cfg.RefreshKeys)
+	if err != nil {
+		return fmt.Errorf("load refresh keys: %w", err)
+	}
+
+	if err := accessKeyring.Replace(cfg.AccessActiveKey, accessKeys...); err != nil {
+		return fmt.Errorf("replace access keyring: %w", err)
+	}
+	if err := refreshKeyring.Replace(cfg.RefreshActiveKey, refreshKeys...); err != nil {
+		return fmt.Errorf("replace refresh keyring: %w", err)
+	}
+	return nil
+}
+
+func watchKeyReload(ctx context.Context, accessKeyring, refreshKeyring *signing.Keyring) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			slog.Info("reloading signing keys")
+
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				slog.Error("failed to reload config", slog.Any("err", err))
+				continue
+			}
+
+			if err := replaceKeyrings(cfg.Tokens, accessKeyring, refreshKeyring); err != nil {
+				slog.Error("failed to reload signing keys", slog.Any("err", err))
+			}
+		}
+	}
+}
+
+func newNotifier(cfg config.Notifier) (*notifier.FanOut, error) {
+	var templatesFS fs.FS = templates.FS
+	if cfg.TemplatesDir != "" {
+		templatesFS = os.DirFS(cfg.TemplatesDir)
+	}
+
+	emailTemplates, err := notifier.LoadTemplates(templatesFS, cfg.DefaultLocale)
+	if err != nil {
+		return nil, fmt.Errorf("load templates: %w", err)
+	}
+
+	channels := make([]notifier.Channel, 0, len(cfg.Channels))
+	for _, channel := range cfg.Channels {
+		var n notifier.Notifier
+		switch channel {
+		case config.ChannelEmail:
+			var sender notifier.EmailNotifier = notifier.NewStubEmailNotifier()
+			if cfg.Driver == config.NotifierSMTP {
+				sender, err = notifier.NewSMTPEmailNotifier(notifier.SMTPConfig{
+					Host:     cfg.SMTP.Host,
+					Port:     cfg.SMTP.Port,
+					Username: cfg.SMTP.Username,
+					Password: cfg.SMTP.Password,
+					From:     cfg.SMTP.From,
+					Security: cfg.SMTP.Security,
+					Auth:     cfg.SMTP.Auth,
+					Timeout:  cfg.SMTP.Timeout,
+				})
+				if err != nil {
+					return nil, fmt.Errorf("create smtp notifier: %w", err)
+				}
+			}
+			n = notifier.NewEmailChannel(sender, emailTemplates)
+		case config.ChannelWebhook:
+			n = notifier.NewWebhookNotifier(notifier.WebhookConfig{
+				URL:          cfg.Webhook.URL,
+				Secret:       cfg.Webhook.Secret,
+				MaxRetries:   cfg.Webhook.MaxRetries,
+				RetryBackoff: cfg.Webhook.RetryBackoff,
+				Client:       &http.Client{Timeout: cfg.Webhook.Timeout},
+			})
+		case config.ChannelTelegram:
+			n = notifier.NewTelegramNotifier(notifier.TelegramConfig{
+				BotToken: cfg.Telegram.BotToken,
+				APIURL:   cfg.Telegram.APIURL,
+				Client:   &http.Client{Timeout: cfg.Telegram.Timeout},
+			}, emailTemplates)
+		case config.ChannelSMS:
+			n = notifier.NewStubSMSNotifier()
+		}
+		channels = append(channels, notifier.Channel{
+			Name:      channel,
+			Notifier:  n,
+			RevokeURL: cfg.SendsRevokeURL(channel),
+		})
+	}
+
+	return notifier.NewFanOut(channels...), nil
+}
+
+func routeRateLimit(cfg config.RouteLimits) v1.RouteRateLimit {
+	return v1.RouteRateLimit{
+		ByIP:   service.RateLimit{Requests: cfg.IP.Requests, Per: cfg.IP.Per, Burst: cfg.IP.Burst},
+		ByUser: service.RateLimit{Requests: cfg.User.Requests, Per: cfg.User.Per, Burst: cfg.User.Burst},
+	}
+}
+
 func main() {
 	flag.StringVar(&configPath, "configPath", "config.yml", "Path to config file")
 	flag.Parse()
@@ -56,6 +194,10 @@ func main() {
 
 	setupLogger(cfg.Env)
 
+	if cfg.Tokens.AccessSecret != "" || cfg.Tokens.RefreshSecret != "" {
+		slog.Warn("tokens.access_secret and tokens.refresh_secret are deprecated, use tokens.access_keys and tokens.refresh_keys")
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
@@ -77,16 +219,180 @@ func main() {
 		os.Exit(1)
 	}
 
+	accessKeyring, refreshKeyring := &signing.Keyring{}, &signing.Keyring{}
+	if err := replaceKeyrings(cfg.Tokens, accessKeyring, refreshKeyring); err != nil {
+		slog.Error("failed to load signing keys", slog.Any("err", err))
+		os.Exit(1)
+	}
+
+	userNotifier, err := newNotifier(cfg.Notifier)
+	if err != nil {
+		slog.Error("failed to create notifier", slog.Any("err", err))
+		os.Exit(1)
+	}
+
+	var userDirectory repository.UserDirectory
+	switch cfg.UserDirectory.Driver {
+	case config.UserDirectoryPostgres:
+		userDirectory = postgresrepo.NewUserDirectory(pool, postgresrepo.UserDirectoryParams{
+			Table:                cfg.UserDirectory.Postgres.Table,
+			IDColumn:             cfg.UserDirectory.Postgres.IDColumn,
+			EmailColumn:          cfg.UserDirectory.Postgres.EmailColumn,
+			PhoneColumn:          cfg.UserDirectory.Postgres.PhoneColumn,
+			TelegramChatIDColumn: cfg.UserDirectory.Postgres.TelegramChatIDColumn,
+			LocaleColumn:         cfg.UserDirectory.Postgres.LocaleColumn,
+			RolesColumn:          cfg.UserDirectory.Postgres.RolesColumn,
+		})
+	case config.UserDirectoryHTTP:
+		userDirectory = userservice.NewUserDirectory(userservice.UserDirectoryParams{
+			Client:      &http.Client{Timeout: cfg.UserDirectory.HTTP.Timeout},
+			URLTemplate: cfg.UserDirectory.HTTP.URL,
+			Token:       cfg.UserDirectory.HTTP.Token,
+		})
+	}
+
+	var accessDenylist repository.AccessTokenDenylist
+	switch cfg.Tokens.AccessDenylist {
+	case config.DenylistMemory:
+		accessDenylist = memory.NewAccessTokenDenylist()
+	case config.DenylistPostgres:
+		accessDenylist = postgresrepo.NewAccessTokenDenylist(pool)
+	}
+
+	var bucketRepo repository.RateLimitBucketRepository
+	switch cfg.RateLimit.Store {
+	case config.RateLimitMemory:
+		bucketRepo = memory.NewRateLimitBucketRepository()
+	case config.RateLimitPostgres:
+		bucketRepo = postgresrepo.NewRateLimitBucketRepository(pool)
+	}
+
+	var geoIP repository.GeoIPLocator
+	if cfg.GeoIP.Enabled() {
+		var dbs []string
+		for _, db := range []string{cfg.GeoIP.CountryDB, cfg.GeoIP.ASNDB} {
+			if db != "" {
+				dbs = append(dbs, db)
+			}
+		}
+
+		locator, err := maxmind.NewGeoIPLocator(dbs...)
+		if err != nil {
+			slog.Error("failed to open geoip databases", slog.Any("err", err))
+			os.Exit(1)
+		}
+		defer locator.Close()
+		geoIP = locator
+	}
+
+	refreshTokenRepo := postgresrepo.NewRefreshTokenRepository(pool)
+	outboxRepo := postgresrepo.NewNotificationOutboxRepository(pool)
+	usedRevokeTokenRepo := postgresrepo.NewUsedRevokeTokenRepository(pool)
+
+	// Tokens issued before refresh tokens had an expiration get one from the
+	// configured lifetime.
+	if n, err := refreshTokenRepo.BackfillExpiresAt(ctx, cfg.Tokens.RefreshTTL); err != nil {
+		slog.Error("failed to backfill refresh token expiration", slog.Any("err", err))
+		os.Exit(1)
+	} else if n > 0 {
+		slog.Info("backfilled refresh token expiration", slog.Int64("tokens", n))
+	}
+
+	audiences := make(map[string]service.AudienceTTL, len(cfg.Tokens.Audiences))
+	for name, aud := range cfg.Tokens.Audiences {
+		audiences[name] = service.AudienceTTL{
+			AccessTTL:  aud.AccessTTL,
+			RefreshTTL: aud.RefreshTTL,
+		}
+	}
+
+	// Roles are looked up on every issuance, so only when there are any.
+	var rolesDirectory repository.UserDirectory
+	if cfg.UserDirectory.HasRoles() {
+		rolesDirectory = userDirectory
+	}
+
 	authService := service.NewAuthService(service.AuthServiceParams{
-		AccessTokenSecret:  []byte(cfg.Tokens.AccessSecret),
+		Issuer:             cfg.Tokens.Issuer,
+		Audience:           cfg.Tokens.Audience,
+		Audiences:          audiences,
+		AccessKeyring:      accessKeyring,
 		AccessTokenTTL:     cfg.Tokens.AccessTTL,
-		RefreshTokenSecret: []byte(cfg.Tokens.RefreshSecret),
+		RefreshKeyring:     refreshKeyring,
 		RefreshTokenTTL:    cfg.Tokens.RefreshTTL,
-		RefreshTokenRepo:   repository.NewRefreshTokenRepository(pool),
-		EmailNotifier:      notifier.NewStubEmailNotifier(),
+		RefreshTokenFormat: cfg.Tokens.RefreshFormat,
+		RevokeTokenTTL:     cfg.Tokens.RevokeTTL,
+		ReuseDetection:     cfg.Tokens.ReuseDetection,
+		IPPolicy: service.IPPolicy{
+			Mode:          cfg.Tokens.IPPolicy.Mode,
+			IPv4PrefixLen: cfg.Tokens.IPPolicy.IPv4Prefix,
+			IPv6PrefixLen: cfg.Tokens.IPPolicy.IPv6Prefix,
+			GeoMatch:      cfg.Tokens.IPPolicy.GeoMatch,
+		},
+		GeoIP:               geoIP,
+		RefreshTokenRepo:    refreshTokenRepo,
+		ClientRepo:          postgresrepo.NewClientRepository(pool),
+		UserDirectory:       rolesDirectory,
+		AccessDenylist:      accessDenylist,
+		UsedRevokeTokenRepo: usedRevokeTokenRepo,
+		OutboxRepo:          outboxRepo,
+		Logger:              slog.Default(),
 	})
 
-	router := api.NewRouter(slog.Default(), authService)
+	notificationDispatcher := service.NewNotificationDispatcher(service.NotificationDispatcherParams{
+		PollInterval:  cfg.Outbox.PollInterval,
+		BatchSize:     cfg.Outbox.BatchSize,
+		Lease:         cfg.Outbox.Lease,
+		MaxAttempts:   cfg.Outbox.MaxAttempts,
+		BaseBackoff:   cfg.Outbox.BaseBackoff,
+		MaxBackoff:    cfg.Outbox.MaxBackoff,
+		OutboxRepo:    outboxRepo,
+		UserDirectory: userDirectory,
+		Notifier:      userNotifier,
+		RevokeURL:     cfg.Notifier.RevokeURL,
+		Logger:        slog.Default(),
+	})
+
+	cleanupService := service.NewCleanupService(service.CleanupServiceParams{
+		Interval:            cfg.Cleanup.Interval,
+		BatchSize:           cfg.Cleanup.BatchSize,
+		Retention:           cfg.Cleanup.Retention,
+		RefreshTokenRepo:    refreshTokenRepo,
+		AccessDenylist:      accessDenylist,
+		UsedRevokeTokenRepo: usedRevokeTokenRepo,
+		OutboxRepo:          outboxRepo,
+		BucketRepo:          bucketRepo,
+		Logger:              slog.Default(),
+	})
+
+	var rateLimiter *service.RateLimiter
+	if bucketRepo != nil {
+		rateLimiter = service.NewRateLimiter(bucketRepo)
+	}
+
+	rateLimits := v1.RateLimits{
+		IssueTokens:   routeRateLimit(cfg.RateLimit.IssueTokens),
+		RefreshTokens: routeRateLimit(cfg.RateLimit.RefreshTokens),
+	}
+
+	trustedProxies, err := clientip.ParsePrefixes(cfg.Server.TrustedProxies)
+	if err != nil {
+		slog.Error("failed to parse trusted proxies", slog.Any("err", err))
+		os.Exit(1)
+	}
+
+	if cfg.Server.PublicURL == "" {
+		slog.Info("openid connect discovery disabled, set server.public_url or an https tokens.issuer to enable it")
+	}
+
+	router := api.NewRouter(
+		slog.Default(),
+		clientip.NewResolver(trustedProxies),
+		authService,
+		rateLimiter,
+		rateLimits,
+		cfg.Server.PublicURL,
+	)
 
 	server := &http.Server{
 		Addr:           cfg.Server.Addr(),
@@ -100,8 +406,48 @@ func main() {
 		},
 	}
 
+	// The admin listener is optional, it serves the runtime counters apart
+	// from the public API.
+	var adminServer *http.Server
+	if cfg.Server.AdminAddr != "" {
+		adminServer = &http.Server{
+			Addr:         cfg.Server.AdminAddr,
+			Handler:      api.NewAdminRouter(),
+			ReadTimeout:  cfg.Server.ReadTimeout,
+			WriteTimeout: cfg.Server.WriteTimeout,
+			IdleTimeout:  cfg.Server.IdleTimeout,
+			BaseContext: func(_ net.Listener) context.Context {
+				return ctx
+			},
+		}
+	}
+
 	var wg sync.WaitGroup
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		watchKeyReload(ctx, accessKeyring, refreshKeyring)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		slog.Info("starting the cleanup job", slog.Duration("interval", cfg.Cleanup.Interval))
+		cleanupService.Run(ctx)
+		slog.Info("cleanup job stopped")
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		slog.Info("starting the notification dispatcher", slog.Duration("poll_interval", cfg.Outbox.PollInterval))
+		notificationDispatcher.Run(ctx)
+		slog.Info("notification dispatcher stopped")
+	}()
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -113,6 +459,19 @@ func main() {
 		}
 	}()
 
+	if adminServer != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			slog.Info("starting the admin server", slog.String("addr", cfg.Server.AdminAddr))
+			if err := adminServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("admin server error", slog.Any("err", err))
+				os.Exit(1)
+			}
+		}()
+	}
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -126,6 +485,12 @@ func main() {
 			slog.Error("failed to shutdown the server", slog.Any("err", err))
 			os.Exit(1)
 		}
+		if adminServer != nil {
+			if err := adminServer.Shutdown(ctx); err != nil {
+				slog.Error("failed to shutdown the admin server", slog.Any("err", err))
+				os.Exit(1)
+			}
+		}
 	}()
 
 	wg.Wait()
@@ -3,6 +3,8 @@ package config
 import (
 	"fmt"
 	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/go-playground/validator/v10"
@@ -15,16 +17,315 @@ const (
 	EnvProd = "prod"
 )
 
+const (
+	DenylistMemory   = "memory"
+	DenylistPostgres = "postgres"
+)
+
+const (
+	RefreshTokenJWT    = "jwt"
+	RefreshTokenOpaque = "opaque"
+)
+
+const (
+	RateLimitMemory   = "memory"
+	RateLimitPostgres = "postgres"
+)
+
+const (
+	NotifierStub = "stub"
+	NotifierSMTP = "smtp"
+)
+
+const (
+	ChannelEmail    = "email"
+	ChannelWebhook  = "webhook"
+	ChannelTelegram = "telegram"
+	ChannelSMS      = "sms"
+)
+
+const (
+	UserDirectoryPostgres = "postgres"
+	UserDirectoryHTTP     = "http"
+)
+
+type SigningKey struct {
+	ID             string    `yaml:"id" validate:"required"`
+	Algorithm      string    `yaml:"algorithm" validate:"oneof=HS512 RS256 ES256 EdDSA"`
+	Secret         string    `yaml:"secret" validate:"required_if=Algorithm HS512"`
+	PrivateKeyPath string    `yaml:"private_key_path" validate:"required_unless=Algorithm HS512"`
+	RetireAt       time.Time `yaml:"retire_at"`
+}
+
 type Tokens struct {
-	AccessSecret  string        `yaml:"access_secret" validate:"required"`
-	AccessTTL     time.Duration `yaml:"access_ttl" validate:"gt=0"`
-	RefreshSecret string        `yaml:"refresh_secret" validate:"required"`
-	RefreshTTL    time.Duration `yaml:"refresh_ttl" validate:"gt=0"`
+	// Issuer is the iss claim of tokens. With OpenID Connect discovery it
+	// must equal the public URL of the server.
+	Issuer string `yaml:"issuer" validate:"required"`
+	// Audience is the audience of the auth service itself. When set, the
+	// session routes only accept access tokens issued for it.
+	Audience string `yaml:"audience"`
+	// Audiences tokens can be issued for, by name.
+	Audiences map[string]Audience `yaml:"audiences" validate:"dive"`
+	// AccessSecret and RefreshSecret are the HS512 secrets of configs
+	// predating key rotation, see applyLegacySecrets.
+	AccessSecret     string        `yaml:"access_secret"`
+	RefreshSecret    string        `yaml:"refresh_secret"`
+	AccessActiveKey  string        `yaml:"access_active_key" validate:"required"`
+	AccessKeys       []SigningKey  `yaml:"access_keys" validate:"required,min=1,unique=ID,dive"`
+	AccessTTL        time.Duration `yaml:"access_ttl" validate:"gt=0"`
+	RefreshActiveKey string        `yaml:"refresh_active_key" validate:"required"`
+	RefreshKeys      []SigningKey  `yaml:"refresh_keys" validate:"required,min=1,unique=ID,dive"`
+	RefreshTTL       time.Duration `yaml:"refresh_ttl" validate:"gt=0"`
+	// RefreshFormat is the format of new refresh tokens, tokens of the
+	// other format stay valid.
+	RefreshFormat  string        `yaml:"refresh_format" validate:"oneof=jwt opaque"`
+	RevokeTTL      time.Duration `yaml:"revoke_ttl" validate:"gt=0"`
+	ReuseDetection bool          `yaml:"reuse_detection"`
+	IPPolicy       IPPolicy      `yaml:"ip_policy" validate:"required"`
+	AccessDenylist string        `yaml:"access_denylist" validate:"omitempty,oneof=memory postgres"`
+}
+
+// Audience overrides the token lifetimes of an audience, zero values keep the
+// defaults.
+type Audience struct {
+	AccessTTL  time.Duration `yaml:"access_ttl" validate:"gte=0"`
+	RefreshTTL time.Duration `yaml:"refresh_ttl" validate:"gte=0"`
+}
+
+// legacyKeyID is the id of the keys made from access_secret and
+// refresh_secret.
+const legacyKeyID = "default"
+
+// applyLegacySecrets turns access_secret and refresh_secret into the active
+// HS512 key of their kind, so that configs written before key rotation keep
+// working. They cannot be combined with keys of the same kind.
+func (t *Tokens) applyLegacySecrets() error {
+	if err := applyLegacySecret("access", t.AccessSecret, &t.AccessActiveKey, &t.AccessKeys); err != nil {
+		return err
+	}
+	return applyLegacySecret("refresh", t.RefreshSecret, &t.RefreshActiveKey, &t.RefreshKeys)
+}
+
+func applyLegacySecret(kind, secret string, activeID *string, keys *[]SigningKey) error {
+	if secret == "" {
+		return nil
+	}
+	if *activeID != "" || len(*keys) > 0 {
+		return fmt.Errorf("tokens.%s_secret cannot be combined with tokens.%s_keys", kind, kind)
+	}
+
+	*activeID = legacyKeyID
+	*keys = []SigningKey{{ID: legacyKeyID, Algorithm: "HS512", Secret: secret}}
+	return nil
+}
+
+type IPPolicy struct {
+	Mode       string `yaml:"mode" validate:"oneof=ignore warn deny subnet"`
+	IPv4Prefix int    `yaml:"ipv4_prefix" validate:"min=0,max=32"`
+	IPv6Prefix int    `yaml:"ipv6_prefix" validate:"min=0,max=128"`
+	GeoMatch   string `yaml:"geo_match" validate:"oneof=none asn country asn_and_country"`
 }
 
 var defautlTokens = Tokens{
-	AccessTTL:  15 * time.Minute,
-	RefreshTTL: time.Hour,
+	Issuer:         "auth-service",
+	AccessTTL:      15 * time.Minute,
+	RefreshTTL:     time.Hour,
+	RefreshFormat:  RefreshTokenJWT,
+	RevokeTTL:      7 * 24 * time.Hour,
+	ReuseDetection: true,
+	IPPolicy: IPPolicy{
+		Mode:       "warn",
+		IPv4Prefix: 24,
+		IPv6Prefix: 48,
+		GeoMatch:   "none",
+	},
+}
+
+type Cleanup struct {
+	Interval  time.Duration `yaml:"interval" validate:"gt=0"`
+	BatchSize int           `yaml:"batch_size" validate:"gt=0"`
+	Retention time.Duration `yaml:"retention" validate:"gte=0"`
+}
+
+var defaultCleanup = Cleanup{
+	Interval:  10 * time.Minute,
+	BatchSize: 1000,
+	Retention: 24 * time.Hour,
+}
+
+type Outbox struct {
+	PollInterval time.Duration `yaml:"poll_interval" validate:"gt=0"`
+	BatchSize    int           `yaml:"batch_size" validate:"gt=0"`
+	Lease        time.Duration `yaml:"lease" validate:"gt=0"`
+	MaxAttempts  int           `yaml:"max_attempts" validate:"gt=0"`
+	BaseBackoff  time.Duration `yaml:"base_backoff" validate:"gt=0"`
+	MaxBackoff   time.Duration `yaml:"max_backoff" validate:"gtefield=BaseBackoff"`
+}
+
+var defaultOutbox = Outbox{
+	PollInterval: 5 * time.Second,
+	BatchSize:    50,
+	Lease:        time.Minute,
+	MaxAttempts:  10,
+	BaseBackoff:  10 * time.Second,
+	MaxBackoff:   time.Hour,
+}
+
+// Limit allows Requests per Per on average and up to Burst at once. Zero
+// Requests disables it.
+type Limit struct {
+	Requests int           `yaml:"requests" validate:"gte=0"`
+	Per      time.Duration `yaml:"per" validate:"required_with=Requests,gte=0"`
+	Burst    int           `yaml:"burst" validate:"required_with=Requests,gte=0"`
+}
+
+type RouteLimits struct {
+	IP   Limit `yaml:"ip"`
+	User Limit `yaml:"user"`
+}
+
+// RateLimit is disabled when no store is set.
+type RateLimit struct {
+	Store         string      `yaml:"store" validate:"omitempty,oneof=memory postgres"`
+	IssueTokens   RouteLimits `yaml:"issue_tokens"`
+	RefreshTokens RouteLimits `yaml:"refresh_tokens"`
+}
+
+var defaultRateLimit = RateLimit{
+	IssueTokens: RouteLimits{
+		IP:   Limit{Requests: 30, Per: time.Minute, Burst: 10},
+		User: Limit{Requests: 10, Per: time.Minute, Burst: 5},
+	},
+	RefreshTokens: RouteLimits{
+		IP:   Limit{Requests: 60, Per: time.Minute, Burst: 20},
+		User: Limit{Requests: 10, Per: time.Minute, Burst: 5},
+	},
+}
+
+// GeoIP is disabled when no database is set.
+type GeoIP struct {
+	CountryDB string `yaml:"country_db" validate:"omitempty,file"`
+	ASNDB     string `yaml:"asn_db" validate:"omitempty,file"`
+}
+
+func (g *GeoIP) Enabled() bool {
+	return g.CountryDB != "" || g.ASNDB != ""
+}
+
+type SMTP struct {
+	Host     string        `yaml:"host" validate:"required"`
+	Port     int           `yaml:"port" validate:"required,min=1,max=65535"`
+	Username string        `yaml:"username" validate:"required_unless=Auth none"`
+	Password string        `yaml:"password" validate:"required_unless=Auth none"`
+	From     string        `yaml:"from" validate:"required"`
+	Security string        `yaml:"security" validate:"oneof=none starttls tls"`
+	Auth     string        `yaml:"auth" validate:"oneof=none plain login"`
+	Timeout  time.Duration `yaml:"timeout" validate:"gt=0"`
+}
+
+type Webhook struct {
+	URL          string        `yaml:"url" validate:"required,url"`
+	Secret       string        `yaml:"secret" validate:"required"`
+	Timeout      time.Duration `yaml:"timeout" validate:"gt=0"`
+	MaxRetries   int           `yaml:"max_retries" validate:"gte=0"`
+	RetryBackoff time.Duration `yaml:"retry_backoff" validate:"gt=0"`
+}
+
+type Telegram struct {
+	BotToken string        `yaml:"bot_token" validate:"required"`
+	APIURL   string        `yaml:"api_url" validate:"omitempty,url"`
+	Timeout  time.Duration `yaml:"timeout" validate:"gt=0"`
+}
+
+type Notifier struct {
+	Channels []string `yaml:"channels" validate:"required,min=1,unique,dive,oneof=email webhook telegram sms"`
+	// Driver is the transport of the email channel.
+	Driver string `yaml:"driver" validate:"oneof=stub smtp"`
+	// TemplatesDir overrides the templates embedded into the binary.
+	TemplatesDir  string `yaml:"templates_dir"`
+	DefaultLocale string `yaml:"default_locale" validate:"required"`
+	RevokeURL     string `yaml:"revoke_url" validate:"omitempty,url,contains={token}"`
+	// RevokeURLChannels are the channels the revoke link is sent to.
+	RevokeURLChannels []string `yaml:"revoke_url_channels" validate:"unique,dive,oneof=email webhook telegram sms"`
+	// SMTP, Webhook and Telegram are validated only when they are used.
+	SMTP     SMTP     `yaml:"smtp" validate:"-"`
+	Webhook  Webhook  `yaml:"webhook" validate:"-"`
+	Telegram Telegram `yaml:"telegram" validate:"-"`
+}
+
+func (n *Notifier) HasChannel(channel string) bool {
+	return slices.Contains(n.Channels, channel)
+}
+
+func (n *Notifier) SendsRevokeURL(channel string) bool {
+	return slices.Contains(n.RevokeURLChannels, channel)
+}
+
+var defaultNotifier = Notifier{
+	Channels:          []string{ChannelEmail},
+	Driver:            NotifierStub,
+	DefaultLocale:     "en",
+	RevokeURLChannels: []string{ChannelEmail},
+	SMTP: SMTP{
+		Port:     587,
+		Security: "starttls",
+		Auth:     "plain",
+		Timeout:  10 * time.Second,
+	},
+	Webhook: Webhook{
+		Timeout:      5 * time.Second,
+		MaxRetries:   3,
+		RetryBackoff: time.Second,
+	},
+	Telegram: Telegram{
+		Timeout: 5 * time.Second,
+	},
+}
+
+type PostgresUserDirectory struct {
+	Table                string `yaml:"table" validate:"required"`
+	IDColumn             string `yaml:"id_column" validate:"required"`
+	EmailColumn          string `yaml:"email_column" validate:"required"`
+	PhoneColumn          string `yaml:"phone_column"`
+	TelegramChatIDColumn string `yaml:"telegram_chat_id_column"`
+	LocaleColumn         string `yaml:"locale_column"`
+	RolesColumn          string `yaml:"roles_column"`
+}
+
+type HTTPUserDirectory struct {
+	URL     string        `yaml:"url" validate:"required,url,contains={user_id}"`
+	Token   string        `yaml:"token"`
+	Timeout time.Duration `yaml:"timeout" validate:"gt=0"`
+}
+
+// UserDirectory is disabled when no driver is set, security notifications are
+// skipped and tokens carry no roles then.
+type UserDirectory struct {
+	Driver string `yaml:"driver" validate:"omitempty,oneof=postgres http"`
+	// Postgres and HTTP are validated only when they are the selected driver.
+	Postgres PostgresUserDirectory `yaml:"postgres" validate:"-"`
+	HTTP     HTTPUserDirectory     `yaml:"http" validate:"-"`
+}
+
+// HasRoles reports whether the directory is a source of user roles.
+func (u *UserDirectory) HasRoles() bool {
+	switch u.Driver {
+	case UserDirectoryPostgres:
+		return u.Postgres.RolesColumn != ""
+	case UserDirectoryHTTP:
+		return true
+	}
+	return false
+}
+
+var defaultUserDirectory = UserDirectory{
+	Postgres: PostgresUserDirectory{
+		IDColumn:    "id",
+		EmailColumn: "email",
+	},
+	HTTP: HTTPUserDirectory{
+		Timeout: 5 * time.Second,
+	},
 }
 
 type Server struct {
@@ -33,6 +334,16 @@ type Server struct {
 	WriteTimeout   time.Duration `yaml:"write_timeout" validate:"gt=0"`
 	IdleTimeout    time.Duration `yaml:"idle_timeout" validate:"gt=0"`
 	MaxHeaderBytes int           `yaml:"max_header_bytes" validate:"gte=0"`
+	// PublicURL is the external https URL of the service, endpoints in the
+	// OpenID Connect discovery document are relative to it. It defaults to the
+	// issuer when that is an https URL, otherwise the document is not served.
+	PublicURL string `yaml:"public_url" validate:"omitempty,url,startswith=https://"`
+	// AdminAddr is the address of the internal listener serving the runtime
+	// counters, e.g. 127.0.0.1:9090. It is disabled when empty.
+	AdminAddr string `yaml:"admin_addr" validate:"omitempty,hostname_port"`
+	// TrustedProxies lists the CIDRs or IPs of reverse proxies whose
+	// forwarding headers are trusted.
+	TrustedProxies []string `yaml:"trusted_proxies" validate:"dive,cidr|ip"`
 }
 
 var defaultServer = Server{
@@ -95,23 +406,99 @@ func (p *Postgres) DSN() string {
 }
 
 type Config struct {
-	Env      string   `yaml:"env" validate:"required,oneof=dev test prod"`
-	Tokens   Tokens   `yaml:"tokens" validate:"required"`
-	Server   Server   `yaml:"server" validate:"required"`
-	Postgres Postgres `yaml:"postgres" validate:"required"`
+	Env           string        `yaml:"env" validate:"required,oneof=dev test prod"`
+	Tokens        Tokens        `yaml:"tokens" validate:"required"`
+	Cleanup       Cleanup       `yaml:"cleanup" validate:"required"`
+	Outbox        Outbox        `yaml:"outbox" validate:"required"`
+	GeoIP         GeoIP         `yaml:"geoip"`
+	RateLimit     RateLimit     `yaml:"rate_limit"`
+	Notifier      Notifier      `yaml:"notifier" validate:"required"`
+	UserDirectory UserDirectory `yaml:"user_directory"`
+	Server        Server        `yaml:"server" validate:"required"`
+	Postgres      Postgres      `yaml:"postgres" validate:"required"`
 }
 
 var defaultConfig = Config{
-	Env:      EnvDev,
-	Tokens:   defautlTokens,
-	Server:   defaultServer,
-	Postgres: defaultPostgres,
+	Env:           EnvDev,
+	Tokens:        defautlTokens,
+	Cleanup:       defaultCleanup,
+	Outbox:        defaultOutbox,
+	RateLimit:     defaultRateLimit,
+	Notifier:      defaultNotifier,
+	UserDirectory: defaultUserDirectory,
+	Server:        defaultServer,
+	Postgres:      defaultPostgres,
 }
 
 var validate = validator.New()
 
+// validateActiveKey checks that the active key is listed and does not retire,
+// a retired key would otherwise keep signing tokens that no longer verify.
+func validateActiveKey(kind, activeID string, keys []SigningKey) error {
+	i := slices.IndexFunc(keys, func(k SigningKey) bool { return k.ID == activeID })
+	if i < 0 {
+		return fmt.Errorf("tokens.%s_active_key %q is not listed in tokens.%s_keys", kind, activeID, kind)
+	}
+	if !keys[i].RetireAt.IsZero() {
+		return fmt.Errorf("tokens.%s_active_key %q must not have retire_at", kind, activeID)
+	}
+	return nil
+}
+
 func (c *Config) validate() error {
-	return validate.Struct(c)
+	if err := validate.Struct(c); err != nil {
+		return err
+	}
+
+	if err := validateActiveKey("access", c.Tokens.AccessActiveKey, c.Tokens.AccessKeys); err != nil {
+		return err
+	}
+	if err := validateActiveKey("refresh", c.Tokens.RefreshActiveKey, c.Tokens.RefreshKeys); err != nil {
+		return err
+	}
+
+	// OpenID Connect requires the issuer to be the URL the discovery
+	// document is served under.
+	if publicURL := strings.TrimSuffix(c.Server.PublicURL, "/"); publicURL != "" && c.Tokens.Issuer != publicURL {
+		return fmt.Errorf("tokens.issuer %q must equal server.public_url %q", c.Tokens.Issuer, publicURL)
+	}
+
+	if _, ok := c.Tokens.Audiences[c.Tokens.Audience]; c.Tokens.Audience != "" && !ok {
+		return fmt.Errorf("tokens.audience %q is not listed in tokens.audiences", c.Tokens.Audience)
+	}
+
+	if c.Tokens.IPPolicy.GeoMatch != "none" && !c.GeoIP.Enabled() {
+		return fmt.Errorf("tokens.ip_policy.geo_match %q requires a geoip database", c.Tokens.IPPolicy.GeoMatch)
+	}
+
+	if c.Notifier.HasChannel(ChannelEmail) && c.Notifier.Driver == NotifierSMTP {
+		if err := validate.Struct(c.Notifier.SMTP); err != nil {
+			return fmt.Errorf("notifier.smtp: %w", err)
+		}
+	}
+	if c.Notifier.HasChannel(ChannelWebhook) {
+		if err := validate.Struct(c.Notifier.Webhook); err != nil {
+			return fmt.Errorf("notifier.webhook: %w", err)
+		}
+	}
+	if c.Notifier.HasChannel(ChannelTelegram) {
+		if err := validate.Struct(c.Notifier.Telegram); err != nil {
+			return fmt.Errorf("notifier.telegram: %w", err)
+		}
+	}
+
+	switch c.UserDirectory.Driver {
+	case UserDirectoryPostgres:
+		if err := validate.Struct(c.UserDirectory.Postgres); err != nil {
+			return fmt.Errorf("user_directory.postgres: %w", err)
+		}
+	case UserDirectoryHTTP:
+		if err := validate.Struct(c.UserDirectory.HTTP); err != nil {
+			return fmt.Errorf("user_directory.http: %w", err)
+		}
+	}
+
+	return nil
 }
 
 func Load(path string) (*Config, error) {
@@ -126,6 +513,14 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("decode config file: %w", err)
 	}
 
+	if err := cfg.Tokens.applyLegacySecrets(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	if cfg.Server.PublicURL == "" && strings.HasPrefix(cfg.Tokens.Issuer, "https://") {
+		cfg.Server.PublicURL = cfg.Tokens.Issuer
+	}
+
 	if err := cfg.validate(); err != nil {
 		return nil, fmt.Errorf("invalid config: %w", err)
 	}
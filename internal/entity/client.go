@@ -0,0 +1,12 @@
+package entity
+
+import "time"
+
+// Client is an application allowed to request tokens.
+type Client struct {
+	ID           string
+	HashedSecret string
+	// Scopes the client may request.
+	Scopes    []string
+	CreatedAt time.Time
+}
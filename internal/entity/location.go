@@ -0,0 +1,30 @@
+package entity
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Location struct {
+	// Country is an ISO 3166-1 alpha-2 code.
+	Country        string `json:"country,omitempty"`
+	ASN            uint   `json:"asn,omitempty"`
+	ASOrganization string `json:"as_organization,omitempty"`
+}
+
+// String formats the location for people, e.g. "DE, AS3320 Deutsche Telekom AG".
+// An unknown, nil location is formatted as an empty string.
+func (l *Location) String() string {
+	if l == nil {
+		return ""
+	}
+
+	var parts []string
+	if l.Country != "" {
+		parts = append(parts, l.Country)
+	}
+	if l.ASN != 0 {
+		parts = append(parts, strings.TrimSpace(fmt.Sprintf("AS%d %s", l.ASN, l.ASOrganization)))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,37 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SecurityEventIPChanged          = "ip_changed"
+	SecurityEventRefreshTokenReused = "refresh_token_reused"
+)
+
+type SecurityEvent struct {
+	Type   string    `json:"type"`
+	UserID uuid.UUID `json:"user_id"`
+	OldIP  string    `json:"old_ip,omitempty"`
+	// OldLocation and NewLocation are empty when GeoIP lookups are disabled
+	// or the IP is unknown.
+	OldLocation string    `json:"old_location,omitempty"`
+	NewIP       string    `json:"new_ip,omitempty"`
+	NewLocation string    `json:"new_location,omitempty"`
+	UserAgent   string    `json:"user_agent,omitempty"`
+	OccurredAt  time.Time `json:"occurred_at"`
+	// RevokeToken lets the user sign out the affected sessions from the
+	// notification without being signed in.
+	RevokeToken string `json:"revoke_token,omitempty"`
+}
+
+type OutboxMessage struct {
+	ID       uuid.UUID
+	Event    SecurityEvent
+	Attempts int
+	// DeliveredChannels are the notification channels earlier attempts
+	// delivered the message to.
+	DeliveredChannels []string
+}
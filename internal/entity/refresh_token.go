@@ -0,0 +1,53 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type RefreshToken struct {
+	UserID    uuid.UUID
+	JTI       uuid.UUID
+	FamilyID  uuid.UUID
+	ParentJTI uuid.NullUUID
+	AccessJTI uuid.UUID
+	// AccessExpiresAt is the expiration of the AccessJTI token, it is zero
+	// for tokens issued before it was recorded.
+	AccessExpiresAt time.Time
+	HashedToken     string
+	// Selector identifies opaque tokens, it is empty for JWT tokens.
+	Selector string
+	Revoked  bool
+	// ClientID is empty for tokens issued before clients were introduced.
+	ClientID string
+	// Scopes granted to the token family.
+	Scopes []string
+	// Audiences the token family is issued for.
+	Audiences []string
+	ClientIP  string
+	UserAgent string
+	// SessionStartedAt is the moment the token family was issued.
+	// A zero value on save means now.
+	SessionStartedAt time.Time
+	CreatedAt        time.Time
+	ExpiresAt        time.Time
+}
+
+// AccessTokenRef is the access token paired with a revoked refresh token.
+type AccessTokenRef struct {
+	JTI uuid.UUID
+	// ExpiresAt is zero when it is unknown.
+	ExpiresAt time.Time
+}
+
+// Session is an active token family, identified by its family id.
+type Session struct {
+	ID       uuid.UUID
+	ClientIP string
+	// Location of ClientIP, nil when unknown.
+	Location        *Location
+	UserAgent       string
+	CreatedAt       time.Time
+	LastRefreshedAt time.Time
+}
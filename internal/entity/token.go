@@ -2,8 +2,28 @@ package entity
 
 import "github.com/golang-jwt/jwt/v5"
 
+const (
+	TokenTypeAccess  = "access_token"
+	TokenTypeRefresh = "refresh_token"
+)
+
 type TokenClaims struct {
 	UserID   string `json:"user_id"`
 	ClientIP string `json:"client_ip"`
+	// AuthorizedParty is the id of the client the token was issued to.
+	AuthorizedParty string `json:"azp,omitempty"`
+	// Scope is the space separated list of granted scopes.
+	Scope string   `json:"scope,omitempty"`
+	Roles []string `json:"roles,omitempty"`
+	// AccessJTI links a refresh token to the access token issued alongside it.
+	AccessJTI string `json:"access_jti,omitempty"`
+	// SessionID is set on session revoke tokens, see AuthService.RevokeSessionsByToken.
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
+
+type TokenIntrospection struct {
+	Active    bool
+	TokenType string
+	Claims    *TokenClaims
+}
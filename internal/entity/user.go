@@ -0,0 +1,15 @@
+package entity
+
+import "github.com/google/uuid"
+
+type User struct {
+	ID    uuid.UUID
+	Email string
+	// Phone and TelegramChatID are optional addresses for other notification channels.
+	Phone          string
+	TelegramChatID string
+	// Locale selects the language of notifications, e.g. "en" or "ru-RU".
+	Locale string
+	// Roles are embedded in access tokens.
+	Roles []string
+}
@@ -1,40 +1,139 @@
 package v1
 
 import (
+	"context"
 	"errors"
-	"net"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 	"github.com/google/uuid"
+	"github.com/vadimbarashkov/medods-test-task/internal/entity"
 	"github.com/vadimbarashkov/medods-test-task/internal/service"
+	"github.com/vadimbarashkov/medods-test-task/pkg/clientip"
+)
+
+const (
+	authPath       = "/auth"
+	introspectPath = "/introspect"
 )
 
 type AuthHandler struct {
 	authService *service.AuthService
+	issueLimit  *routeLimiter
 }
 
-func RegisterAuthRoutes(r chi.Router, authService *service.AuthService) {
-	h := &AuthHandler{authService: authService}
+func RegisterAuthRoutes(
+	r chi.Router,
+	authService *service.AuthService,
+	rateLimiter *service.RateLimiter,
+	rateLimits RateLimits,
+) {
+	issueLimiter := newRouteLimiter(rateLimiter, "issue_tokens", rateLimits.IssueTokens)
+	h := &AuthHandler{
+		authService: authService,
+		issueLimit:  issueLimiter,
+	}
+
+	bearerToken := func(r *http.Request) string {
+		token, _ := extractBearerToken(r)
+		return token
+	}
 
-	r.Route("/auth", func(r chi.Router) {
-		r.Post("/tokens", h.IssueTokens)
-		r.Post("/tokens/refresh", h.RefreshTokens)
+	// The user_id of a token request is only trusted once the client is
+	// authenticated, IssueTokens applies the per-user limit itself.
+	issueLimit := rateLimit(issueLimiter, nil)
+	refreshLimit := rateLimit(
+		newRouteLimiter(rateLimiter, "refresh_tokens", rateLimits.RefreshTokens),
+		refreshTokensUserKey(authService, bearerToken),
+	)
+
+	r.Route(authPath, func(r chi.Router) {
+		r.With(issueLimit).Post("/tokens", h.IssueTokens)
+		r.With(refreshLimit).Post("/tokens/refresh", h.RefreshTokens)
+		r.Post("/logout", h.Logout)
+		r.Post("/logout/all", h.LogoutAll)
+		r.Post(introspectPath, h.Introspect)
+		r.Post("/sessions/revoke", h.RevokeSessionsByToken)
+
+		r.Group(func(r chi.Router) {
+			r.Use(h.Authenticate)
+			r.Get("/sessions", h.ListSessions)
+			r.Delete("/sessions/{id}", h.RevokeSession)
+		})
 	})
 }
 
+type RefreshTokensRequest struct {
+	AccessToken string `json:"access_token"`
+	// Scope optionally narrows the scopes of the new access token.
+	Scope string `json:"scope,omitempty"`
+	// Audience optionally narrows the audiences of the new access token.
+	Audience []string `json:"audience,omitempty"`
+}
+
 type TokensResponse struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope,omitempty"`
 }
 
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
+// clientCredentials reads the client credentials from HTTP Basic auth or, if
+// it is absent, from the client_id and client_secret form fields. Basic auth
+// credentials are form-urlencoded as RFC 6749 requires.
+func clientCredentials(r *http.Request) (string, string, bool) {
+	if clientID, secret, ok := r.BasicAuth(); ok {
+		clientID, errID := url.QueryUnescape(clientID)
+		secret, errSecret := url.QueryUnescape(secret)
+		return clientID, secret, errID == nil && errSecret == nil
+	}
+
+	clientID, secret := r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	return clientID, secret, clientID != "" && secret != ""
+}
+
+func (h *AuthHandler) authenticateClient(w http.ResponseWriter, r *http.Request) (*entity.Client, bool) {
+	clientID, secret, ok := clientCredentials(r)
+
+	var (
+		client *entity.Client
+		err    error
+	)
+	if ok {
+		client, err = h.authService.AuthenticateClient(r.Context(), clientID, secret)
+	}
+
+	switch {
+	case !ok || errors.Is(err, service.ErrInvalidClient):
+		w.Header().Set("WWW-Authenticate", `Basic realm="auth-service"`)
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, ErrorResponse{
+			Error: "missing or invalid client credentials",
+		})
+		return nil, false
+	case err != nil:
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, ErrorResponse{
+			Error: "failed to authenticate client",
+		})
+		return nil, false
+	}
+
+	return client, true
+}
+
 func (h *AuthHandler) IssueTokens(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
 	userIDParam := r.URL.Query().Get("user_id")
 	if userIDParam == "" {
 		render.Status(r, http.StatusBadRequest)
@@ -53,13 +152,35 @@ func (h *AuthHandler) IssueTokens(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		clientIP = r.RemoteAddr
+	if !h.issueLimit.allowUser(w, r, userID) {
+		return
 	}
 
-	accessToken, refreshToken, err := h.authService.IssueTokens(r.Context(), userID, net.ParseIP(clientIP))
+	clientIP, _ := clientip.FromContext(r.Context())
+
+	tokens, err := h.authService.IssueTokens(r.Context(), service.IssueTokensParams{
+		UserID:    userID,
+		Client:    client,
+		Scopes:    service.ParseScope(r.URL.Query().Get("scope")),
+		Audiences: r.URL.Query()["audience"],
+		ClientIP:  clientIP,
+		UserAgent: r.UserAgent(),
+	})
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidScope) {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, ErrorResponse{
+				Error: "scope not allowed for client",
+			})
+			return
+		}
+		if errors.Is(err, service.ErrInvalidAudience) {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, ErrorResponse{
+				Error: "unknown audience",
+			})
+			return
+		}
 		render.Status(r, http.StatusInternalServerError)
 		render.JSON(w, r, ErrorResponse{
 			Error: "failed to issue tokens",
@@ -68,10 +189,15 @@ func (h *AuthHandler) IssueTokens(w http.ResponseWriter, r *http.Request) {
 	}
 
 	render.Status(r, http.StatusOK)
-	render.JSON(w, r, TokensResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-	})
+	render.JSON(w, r, tokensResponse(tokens))
+}
+
+func tokensResponse(tokens *service.IssuedTokens) TokensResponse {
+	return TokensResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		Scope:        service.FormatScope(tokens.Scopes),
+	}
 }
 
 func extractBearerToken(r *http.Request) (string, error) {
@@ -98,13 +224,40 @@ func (h *AuthHandler) RefreshTokens(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		clientIP = r.RemoteAddr
+	var req RefreshTokensRequest
+	if err := render.DecodeJSON(r.Body, &req); err != nil || req.AccessToken == "" {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, ErrorResponse{
+			Error: "missing or invalid access_token in request body",
+		})
+		return
 	}
 
-	accessToken, newRefreshToken, err := h.authService.RefreshTokens(r.Context(), refreshToken, net.ParseIP(clientIP))
+	clientIP, _ := clientip.FromContext(r.Context())
+
+	tokens, err := h.authService.RefreshTokens(r.Context(), service.RefreshTokensParams{
+		AccessToken:  req.AccessToken,
+		RefreshToken: refreshToken,
+		Scopes:       service.ParseScope(req.Scope),
+		Audiences:    req.Audience,
+		ClientIP:     clientIP,
+		UserAgent:    r.UserAgent(),
+	})
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidScope) {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, ErrorResponse{
+				Error: "scope not granted to refresh token",
+			})
+			return
+		}
+		if errors.Is(err, service.ErrInvalidAudience) {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, ErrorResponse{
+				Error: "audience not granted to refresh token",
+			})
+			return
+		}
 		if errors.Is(err, service.ErrInvalidToken) {
 			render.Status(r, http.StatusUnauthorized)
 			render.JSON(w, r, ErrorResponse{
@@ -112,6 +265,27 @@ func (h *AuthHandler) RefreshTokens(w http.ResponseWriter, r *http.Request) {
 			})
 			return
 		}
+		if errors.Is(err, service.ErrTokenPairMismatch) {
+			render.Status(r, http.StatusUnauthorized)
+			render.JSON(w, r, ErrorResponse{
+				Error: "access and refresh tokens were not issued together",
+			})
+			return
+		}
+		if errors.Is(err, service.ErrTokenReused) {
+			render.Status(r, http.StatusUnauthorized)
+			render.JSON(w, r, ErrorResponse{
+				Error: "refresh token reuse detected",
+			})
+			return
+		}
+		if errors.Is(err, service.ErrClientIPChanged) {
+			render.Status(r, http.StatusUnauthorized)
+			render.JSON(w, r, ErrorResponse{
+				Error: "client ip changed, sign in again",
+			})
+			return
+		}
 		render.Status(r, http.StatusInternalServerError)
 		render.JSON(w, r, ErrorResponse{
 			Error: "failed to refresh tokens",
@@ -120,8 +294,105 @@ func (h *AuthHandler) RefreshTokens(w http.ResponseWriter, r *http.Request) {
 	}
 
 	render.Status(r, http.StatusOK)
-	render.JSON(w, r, TokensResponse{
-		AccessToken:  accessToken,
-		RefreshToken: newRefreshToken,
-	})
+	render.JSON(w, r, tokensResponse(tokens))
+}
+
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	h.logout(w, r, h.authService.Logout)
+}
+
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	h.logout(w, r, h.authService.LogoutAll)
+}
+
+func (h *AuthHandler) logout(
+	w http.ResponseWriter,
+	r *http.Request,
+	revoke func(ctx context.Context, refreshToken string) error,
+) {
+	refreshToken, err := extractBearerToken(r)
+	if err != nil {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, ErrorResponse{
+			Error: "missing or invalid authorization header",
+		})
+		return
+	}
+
+	if err := revoke(r.Context(), refreshToken); err != nil {
+		if errors.Is(err, service.ErrInvalidToken) {
+			render.Status(r, http.StatusUnauthorized)
+			render.JSON(w, r, ErrorResponse{
+				Error: "invalid refresh token",
+			})
+			return
+		}
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, ErrorResponse{
+			Error: "failed to logout",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type IntrospectionResponse struct {
+	Active    bool     `json:"active"`
+	Sub       string   `json:"sub,omitempty"`
+	Aud       []string `json:"aud,omitempty"`
+	Exp       int64    `json:"exp,omitempty"`
+	Iat       int64    `json:"iat,omitempty"`
+	Jti       string   `json:"jti,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	ClientIP  string   `json:"client_ip,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+}
+
+// Introspect reports whether a token is active (RFC 7662). Only registered
+// clients may call it, so that it cannot be used to scan for valid tokens.
+func (h *AuthHandler) Introspect(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.authenticateClient(w, r); !ok {
+		return
+	}
+
+	token := r.PostFormValue("token")
+	if token == "" {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, ErrorResponse{
+			Error: "missing token form field",
+		})
+		return
+	}
+
+	result, err := h.authService.IntrospectToken(r.Context(), token, r.PostFormValue("token_type_hint"))
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, ErrorResponse{
+			Error: "failed to introspect token",
+		})
+		return
+	}
+
+	resp := IntrospectionResponse{Active: result.Active}
+	if result.Active {
+		resp.Sub = result.Claims.UserID
+		resp.Aud = result.Claims.Audience
+		resp.Jti = result.Claims.ID
+		resp.Scope = result.Claims.Scope
+		resp.ClientID = result.Claims.AuthorizedParty
+		resp.ClientIP = result.Claims.ClientIP
+		resp.TokenType = result.TokenType
+		if result.Claims.ExpiresAt != nil {
+			resp.Exp = result.Claims.ExpiresAt.Unix()
+		}
+		if result.Claims.IssuedAt != nil {
+			resp.Iat = result.Claims.IssuedAt.Unix()
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, resp)
 }
@@ -0,0 +1,297 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/vadimbarashkov/medods-test-task/internal/entity"
+	"github.com/vadimbarashkov/medods-test-task/internal/service"
+	"github.com/vadimbarashkov/medods-test-task/pkg/clientip"
+)
+
+const (
+	grantTypeClientCredentials = "client_credentials"
+	grantTypeRefreshToken      = "refresh_token"
+)
+
+// Error codes of RFC 6749 section 5.2, RFC 7009 and RFC 8707.
+const (
+	oauthErrInvalidRequest       = "invalid_request"
+	oauthErrInvalidClient        = "invalid_client"
+	oauthErrInvalidGrant         = "invalid_grant"
+	oauthErrInvalidScope         = "invalid_scope"
+	oauthErrInvalidTarget        = "invalid_target"
+	oauthErrUnauthorizedClient   = "unauthorized_client"
+	oauthErrUnsupportedGrantType = "unsupported_grant_type"
+	oauthErrUnsupportedTokenType = "unsupported_token_type"
+	oauthErrServerError          = "server_error"
+)
+
+const (
+	oauthTokenPath  = "/oauth/token"
+	oauthRevokePath = "/oauth/revoke"
+)
+
+// OAuthHandler serves an OAuth 2.0 token endpoint on top of the same tokens
+// as the /auth routes.
+type OAuthHandler struct {
+	authService *service.AuthService
+	issueLimit  *routeLimiter
+}
+
+func RegisterOAuthRoutes(
+	r chi.Router,
+	authService *service.AuthService,
+	rateLimiter *service.RateLimiter,
+	rateLimits RateLimits,
+) {
+	// Grants share the limits of the /auth routes issuing the same tokens.
+	issueLimiter := newRouteLimiter(rateLimiter, "issue_tokens", rateLimits.IssueTokens)
+	h := &OAuthHandler{
+		authService: authService,
+		issueLimit:  issueLimiter,
+	}
+
+	formRefreshToken := func(r *http.Request) string {
+		return r.PostFormValue("refresh_token")
+	}
+
+	// As on /auth/tokens, clientCredentialsGrant applies the per-user limit
+	// once the client is authenticated.
+	issueLimit := rateLimit(issueLimiter, nil)
+	refreshLimit := rateLimit(
+		newRouteLimiter(rateLimiter, "refresh_tokens", rateLimits.RefreshTokens),
+		refreshTokensUserKey(authService, formRefreshToken),
+	)
+
+	r.With(grantRateLimit(issueLimit, refreshLimit)).Post(oauthTokenPath, h.Token)
+	r.Post(oauthRevokePath, h.Revoke)
+}
+
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+func oauthError(w http.ResponseWriter, r *http.Request, status int, code, description string) {
+	if code == oauthErrInvalidClient {
+		w.Header().Set("WWW-Authenticate", `Basic realm="auth-service"`)
+	}
+	render.Status(r, status)
+	render.JSON(w, r, OAuthErrorResponse{
+		Error:            code,
+		ErrorDescription: description,
+	})
+}
+
+func (h *OAuthHandler) authenticateClient(w http.ResponseWriter, r *http.Request) (*entity.Client, bool) {
+	clientID, secret, ok := clientCredentials(r)
+	if !ok {
+		oauthError(w, r, http.StatusUnauthorized, oauthErrInvalidClient, "missing client credentials")
+		return nil, false
+	}
+
+	client, err := h.authService.AuthenticateClient(r.Context(), clientID, secret)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidClient) {
+			oauthError(w, r, http.StatusUnauthorized, oauthErrInvalidClient, "invalid client credentials")
+			return nil, false
+		}
+		oauthError(w, r, http.StatusInternalServerError, oauthErrServerError, "failed to authenticate client")
+		return nil, false
+	}
+
+	return client, true
+}
+
+func (h *OAuthHandler) Token(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, r, http.StatusBadRequest, oauthErrInvalidRequest, "malformed request body")
+		return
+	}
+
+	grantType := r.PostFormValue("grant_type")
+	switch grantType {
+	case "":
+		oauthError(w, r, http.StatusBadRequest, oauthErrInvalidRequest, "missing grant_type")
+		return
+	case grantTypeClientCredentials, grantTypeRefreshToken:
+	default:
+		oauthError(w, r, http.StatusBadRequest, oauthErrUnsupportedGrantType, "")
+		return
+	}
+
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	if grantType == grantTypeRefreshToken {
+		h.refreshTokenGrant(w, r, client)
+		return
+	}
+	h.clientCredentialsGrant(w, r, client)
+}
+
+// clientCredentialsGrant issues tokens of the user in the user_id extension
+// parameter to the client. Unlike the plain grant of RFC 6749 section 4.4.3
+// it issues a refresh token too: the tokens belong to a user session, which
+// the client keeps alive with the refresh_token grant and the user can list
+// and revoke like the sessions of /api/v1/auth/tokens.
+func (h *OAuthHandler) clientCredentialsGrant(w http.ResponseWriter, r *http.Request, client *entity.Client) {
+	userIDParam := r.PostFormValue("user_id")
+	if userIDParam == "" {
+		oauthError(w, r, http.StatusBadRequest, oauthErrInvalidRequest, "missing user_id")
+		return
+	}
+
+	userID, err := uuid.Parse(userIDParam)
+	if err != nil {
+		oauthError(w, r, http.StatusBadRequest, oauthErrInvalidRequest, "invalid user_id")
+		return
+	}
+
+	if !h.issueLimit.allowUser(w, r, userID) {
+		return
+	}
+
+	clientIP, _ := clientip.FromContext(r.Context())
+
+	tokens, err := h.authService.IssueTokens(r.Context(), service.IssueTokensParams{
+		UserID:    userID,
+		Client:    client,
+		Scopes:    service.ParseScope(r.PostFormValue("scope")),
+		Audiences: r.PostForm["audience"],
+		ClientIP:  clientIP,
+		UserAgent: r.UserAgent(),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidScope):
+			oauthError(w, r, http.StatusBadRequest, oauthErrInvalidScope, "scope not allowed for client")
+		case errors.Is(err, service.ErrInvalidAudience):
+			oauthError(w, r, http.StatusBadRequest, oauthErrInvalidTarget, "unknown audience")
+		default:
+			oauthError(w, r, http.StatusInternalServerError, oauthErrServerError, "failed to issue tokens")
+		}
+		return
+	}
+
+	h.renderTokens(w, r, tokens)
+}
+
+func (h *OAuthHandler) refreshTokenGrant(w http.ResponseWriter, r *http.Request, client *entity.Client) {
+	refreshToken := r.PostFormValue("refresh_token")
+	if refreshToken == "" {
+		oauthError(w, r, http.StatusBadRequest, oauthErrInvalidRequest, "missing refresh_token")
+		return
+	}
+
+	clientIP, _ := clientip.FromContext(r.Context())
+
+	tokens, err := h.authService.RefreshTokens(r.Context(), service.RefreshTokensParams{
+		RefreshToken: refreshToken,
+		ClientID:     client.ID,
+		Scopes:       service.ParseScope(r.PostFormValue("scope")),
+		Audiences:    r.PostForm["audience"],
+		ClientIP:     clientIP,
+		UserAgent:    r.UserAgent(),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidScope):
+			oauthError(w, r, http.StatusBadRequest, oauthErrInvalidScope, "scope not granted to refresh token")
+		case errors.Is(err, service.ErrInvalidAudience):
+			oauthError(w, r, http.StatusBadRequest, oauthErrInvalidTarget, "audience not granted to refresh token")
+		case errors.Is(err, service.ErrInvalidToken):
+			oauthError(w, r, http.StatusBadRequest, oauthErrInvalidGrant, "invalid refresh token")
+		case errors.Is(err, service.ErrTokenReused):
+			oauthError(w, r, http.StatusBadRequest, oauthErrInvalidGrant, "refresh token reuse detected")
+		case errors.Is(err, service.ErrClientMismatch):
+			oauthError(w, r, http.StatusBadRequest, oauthErrInvalidGrant, "refresh token was issued to another client")
+		case errors.Is(err, service.ErrClientIPChanged):
+			oauthError(w, r, http.StatusBadRequest, oauthErrInvalidGrant, "client ip changed, sign in again")
+		default:
+			oauthError(w, r, http.StatusInternalServerError, oauthErrServerError, "failed to refresh tokens")
+		}
+		return
+	}
+
+	h.renderTokens(w, r, tokens)
+}
+
+func (h *OAuthHandler) renderTokens(w http.ResponseWriter, r *http.Request, tokens *service.IssuedTokens) {
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, OAuthTokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(tokens.ExpiresIn.Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		Scope:        service.FormatScope(tokens.Scopes),
+	})
+}
+
+// Revoke revokes a token issued to the client (RFC 7009). Revoking an invalid
+// or already revoked token succeeds.
+func (h *OAuthHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, r, http.StatusBadRequest, oauthErrInvalidRequest, "malformed request body")
+		return
+	}
+
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	token := r.PostFormValue("token")
+	if token == "" {
+		oauthError(w, r, http.StatusBadRequest, oauthErrInvalidRequest, "missing token")
+		return
+	}
+
+	err := h.authService.RevokeToken(r.Context(), token, r.PostFormValue("token_type_hint"), client.ID)
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusOK)
+	case errors.Is(err, service.ErrClientMismatch):
+		oauthError(w, r, http.StatusBadRequest, oauthErrUnauthorizedClient, "token was issued to another client")
+	case errors.Is(err, service.ErrAccessTokenRevocationUnsupported):
+		oauthError(w, r, http.StatusBadRequest, oauthErrUnsupportedTokenType, "access tokens cannot be revoked")
+	default:
+		oauthError(w, r, http.StatusInternalServerError, oauthErrServerError, "failed to revoke token")
+	}
+}
+
+// grantRateLimit applies the limit of the requested grant.
+func grantRateLimit(clientCredentials, refreshToken func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		issue, refresh := clientCredentials(next), refreshToken(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := r.ParseForm(); err != nil {
+				oauthError(w, r, http.StatusBadRequest, oauthErrInvalidRequest, "malformed request body")
+				return
+			}
+
+			if r.PostForm.Get("grant_type") == grantTypeRefreshToken {
+				refresh.ServeHTTP(w, r)
+				return
+			}
+			issue.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package v1
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/vadimbarashkov/medods-test-task/internal/service"
+	"github.com/vadimbarashkov/medods-test-task/pkg/clientip"
+)
+
+type RouteRateLimit struct {
+	ByIP   service.RateLimit
+	ByUser service.RateLimit
+}
+
+type RateLimits struct {
+	IssueTokens   RouteRateLimit
+	RefreshTokens RouteRateLimit
+}
+
+// routeLimiter limits requests to a route by client IP and by user. A nil
+// rateLimiter disables limits.
+type routeLimiter struct {
+	rateLimiter *service.RateLimiter
+	route       string
+	limit       RouteRateLimit
+}
+
+func newRouteLimiter(rateLimiter *service.RateLimiter, route string, limit RouteRateLimit) *routeLimiter {
+	return &routeLimiter{
+		rateLimiter: rateLimiter,
+		route:       route,
+		limit:       limit,
+	}
+}
+
+// allowIP reports whether the client IP is within its limit. When it is not,
+// the request has been answered.
+func (l *routeLimiter) allowIP(w http.ResponseWriter, r *http.Request) bool {
+	ip, ok := clientip.FromContext(r.Context())
+	if !ok || ip == nil {
+		return true
+	}
+	return l.allow(w, r, l.route+":ip:"+ip.String(), l.limit.ByIP)
+}
+
+// allowUser is like allowIP for the user. The user must come from something
+// the caller proved it owns, e.g. its credentials or a valid token, so that
+// forged requests do not use up the limit of another user.
+func (l *routeLimiter) allowUser(w http.ResponseWriter, r *http.Request, userID uuid.UUID) bool {
+	return l.allow(w, r, l.route+":user:"+userID.String(), l.limit.ByUser)
+}
+
+func (l *routeLimiter) allow(w http.ResponseWriter, r *http.Request, key string, limit service.RateLimit) bool {
+	if l.rateLimiter == nil || !limit.Enabled() {
+		return true
+	}
+
+	result, err := l.rateLimiter.Allow(r.Context(), key, limit)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, ErrorResponse{
+			Error: "failed to check rate limit",
+		})
+		return false
+	}
+
+	if !result.Allowed {
+		setRateLimitHeaders(w, result)
+		w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+		render.Status(r, http.StatusTooManyRequests)
+		render.JSON(w, r, ErrorResponse{
+			Error: "too many requests",
+		})
+		return false
+	}
+
+	// The headers describe the tightest of the limits checked so far.
+	remaining, err := strconv.Atoi(w.Header().Get("RateLimit-Remaining"))
+	if err != nil || result.Remaining < remaining {
+		setRateLimitHeaders(w, result)
+	}
+	return true
+}
+
+// rateLimit limits requests by client IP and, if userKey is set, by the user
+// it returns. Requests userKey finds no user for are limited by IP only.
+func rateLimit(l *routeLimiter, userKey func(*http.Request) (uuid.UUID, bool)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !l.allowIP(w, r) {
+				return
+			}
+			if userKey != nil {
+				if userID, ok := userKey(r); ok && !l.allowUser(w, r, userID) {
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func setRateLimitHeaders(w http.ResponseWriter, result *service.RateLimitResult) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// refreshTokensUserKey returns a userKey that takes the user from the refresh
+// token, which only its owner can present.
+func refreshTokensUserKey(
+	authService *service.AuthService,
+	refreshToken func(*http.Request) string,
+) func(*http.Request) (uuid.UUID, bool) {
+	return func(r *http.Request) (uuid.UUID, bool) {
+		userID, err := authService.RefreshTokenUserID(r.Context(), refreshToken(r))
+		return userID, err == nil
+	}
+}
@@ -0,0 +1,170 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/vadimbarashkov/medods-test-task/internal/entity"
+	"github.com/vadimbarashkov/medods-test-task/internal/service"
+)
+
+type SessionResponse struct {
+	ID              string           `json:"id"`
+	ClientIP        string           `json:"client_ip"`
+	Location        *entity.Location `json:"location,omitempty"`
+	UserAgent       string           `json:"user_agent"`
+	CreatedAt       time.Time        `json:"created_at"`
+	LastRefreshedAt time.Time        `json:"last_refreshed_at"`
+}
+
+type claimsKey struct{}
+
+// Authenticate verifies the bearer access token, including the denylist,
+// and stores its claims in the request context.
+func (h *AuthHandler) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accessToken, err := extractBearerToken(r)
+		if err != nil {
+			render.Status(r, http.StatusUnauthorized)
+			render.JSON(w, r, ErrorResponse{
+				Error: "missing or invalid authorization header",
+			})
+			return
+		}
+
+		claims, err := h.authService.VerifyAccessToken(r.Context(), accessToken)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidToken) || errors.Is(err, service.ErrTokenRevoked) {
+				render.Status(r, http.StatusUnauthorized)
+				render.JSON(w, r, ErrorResponse{
+					Error: "invalid access token",
+				})
+				return
+			}
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, ErrorResponse{
+				Error: "failed to verify access token",
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims)))
+	})
+}
+
+func userIDFromContext(r *http.Request) (uuid.UUID, bool) {
+	claims, ok := r.Context().Value(claimsKey{}).(*entity.TokenClaims)
+	if !ok {
+		return uuid.Nil, false
+	}
+	userID, err := uuid.Parse(claims.UserID)
+	return userID, err == nil
+}
+
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, ErrorResponse{
+			Error: "invalid access token",
+		})
+		return
+	}
+
+	sessions, err := h.authService.ListSessions(r.Context(), userID)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, ErrorResponse{
+			Error: "failed to list sessions",
+		})
+		return
+	}
+
+	resp := make([]SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		resp = append(resp, SessionResponse{
+			ID:              s.ID.String(),
+			ClientIP:        s.ClientIP,
+			Location:        s.Location,
+			UserAgent:       s.UserAgent,
+			CreatedAt:       s.CreatedAt,
+			LastRefreshedAt: s.LastRefreshedAt,
+		})
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, resp)
+}
+
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		render.Status(r, http.StatusUnauthorized)
+		render.JSON(w, r, ErrorResponse{
+			Error: "invalid access token",
+		})
+		return
+	}
+
+	sessionID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, ErrorResponse{
+			Error: "invalid session id",
+		})
+		return
+	}
+
+	if err := h.authService.RevokeSession(r.Context(), userID, sessionID); err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, ErrorResponse{
+				Error: "session not found",
+			})
+			return
+		}
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, ErrorResponse{
+			Error: "failed to revoke session",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeSessionsByToken handles the "this wasn't me" link from security
+// notifications. The link opens a page that posts the token here, a GET
+// would be followed by mail scanners and prefetchers.
+func (h *AuthHandler) RevokeSessionsByToken(w http.ResponseWriter, r *http.Request) {
+	token := r.PostFormValue("token")
+	if token == "" {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, ErrorResponse{
+			Error: "missing token form field",
+		})
+		return
+	}
+
+	if err := h.authService.RevokeSessionsByToken(r.Context(), token); err != nil {
+		if errors.Is(err, service.ErrInvalidToken) {
+			render.Status(r, http.StatusUnauthorized)
+			render.JSON(w, r, ErrorResponse{
+				Error: "invalid revoke token",
+			})
+			return
+		}
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, ErrorResponse{
+			Error: "failed to revoke sessions",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
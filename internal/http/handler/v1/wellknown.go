@@ -0,0 +1,121 @@
+package v1
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/vadimbarashkov/medods-test-task/internal/service"
+)
+
+// Prefix is the path the v1 API is mounted at.
+const Prefix = "/api/v1"
+
+const jwksPath = "/.well-known/jwks.json"
+
+type WellKnownHandler struct {
+	authService *service.AuthService
+	publicURL   string
+	endpoints   func() openIDEndpoints
+}
+
+// RegisterWellKnownRoutes registers the discovery routes. r must be the root
+// router, the endpoints listed in the discovery document are looked up in it.
+func RegisterWellKnownRoutes(r chi.Router, authService *service.AuthService, publicURL string) {
+	h := &WellKnownHandler{
+		authService: authService,
+		publicURL:   strings.TrimSuffix(publicURL, "/"),
+	}
+	// Routes registered after this call are only complete once the router
+	// serves requests.
+	h.endpoints = sync.OnceValue(func() openIDEndpoints {
+		return findOpenIDEndpoints(r)
+	})
+
+	r.Get(jwksPath, h.JWKS)
+
+	// Endpoint URLs are only known when the public URL is configured, they
+	// are not taken from the request headers.
+	if h.publicURL != "" {
+		r.Get("/.well-known/openid-configuration", h.OpenIDConfiguration)
+	}
+}
+
+func (h *WellKnownHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, h.authService.JWKS())
+}
+
+type OpenIDConfiguration struct {
+	Issuer                                    string   `json:"issuer"`
+	TokenEndpoint                             string   `json:"token_endpoint"`
+	TokenEndpointAuthMethodsSupported         []string `json:"token_endpoint_auth_methods_supported"`
+	IntrospectionEndpoint                     string   `json:"introspection_endpoint,omitempty"`
+	IntrospectionEndpointAuthMethodsSupported []string `json:"introspection_endpoint_auth_methods_supported,omitempty"`
+	RevocationEndpoint                        string   `json:"revocation_endpoint,omitempty"`
+	RevocationEndpointAuthMethodsSupported    []string `json:"revocation_endpoint_auth_methods_supported,omitempty"`
+	JWKSURI                                   string   `json:"jwks_uri"`
+	GrantTypesSupported                       []string `json:"grant_types_supported"`
+	ResponseTypesSupported                    []string `json:"response_types_supported"`
+	SubjectTypesSupported                     []string `json:"subject_types_supported"`
+	// No ID tokens are issued, these are the algorithms of access tokens,
+	// which are verified with the same keys.
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+}
+
+func (h *WellKnownHandler) OpenIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	endpoints := h.endpoints()
+	clientAuthMethods := []string{"client_secret_basic", "client_secret_post"}
+
+	cfg := OpenIDConfiguration{
+		Issuer:                            h.authService.Issuer(),
+		TokenEndpoint:                     h.publicURL + endpoints.token,
+		TokenEndpointAuthMethodsSupported: clientAuthMethods,
+		JWKSURI:                           h.publicURL + endpoints.jwks,
+		GrantTypesSupported:               []string{grantTypeClientCredentials, grantTypeRefreshToken},
+		ResponseTypesSupported:            []string{},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  h.authService.SigningAlgorithms(),
+	}
+	if endpoints.introspection != "" {
+		cfg.IntrospectionEndpoint = h.publicURL + endpoints.introspection
+		cfg.IntrospectionEndpointAuthMethodsSupported = clientAuthMethods
+	}
+	if endpoints.revocation != "" {
+		cfg.RevocationEndpoint = h.publicURL + endpoints.revocation
+		cfg.RevocationEndpointAuthMethodsSupported = clientAuthMethods
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, cfg)
+}
+
+// openIDEndpoints are the full paths the discovery endpoints are routed at.
+type openIDEndpoints struct {
+	token         string
+	introspection string
+	revocation    string
+	jwks          string
+}
+
+func findOpenIDEndpoints(routes chi.Routes) openIDEndpoints {
+	var e openIDEndpoints
+	_ = chi.Walk(routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		switch {
+		case method == http.MethodPost && strings.HasSuffix(route, oauthTokenPath):
+			e.token = route
+		case method == http.MethodPost && strings.HasSuffix(route, authPath+introspectPath):
+			e.introspection = route
+		case method == http.MethodPost && strings.HasSuffix(route, oauthRevokePath):
+			e.revocation = route
+		case method == http.MethodGet && strings.HasSuffix(route, jwksPath):
+			e.jwks = route
+		}
+		return nil
+	})
+	return e
+}
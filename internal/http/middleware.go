@@ -4,6 +4,8 @@ import (
 	"log/slog"
 	"net/http"
 	"time"
+
+	"github.com/vadimbarashkov/medods-test-task/pkg/clientip"
 )
 
 type responseWriterWrapper struct {
@@ -31,6 +33,7 @@ func SlogLogger(logger *slog.Logger) func(http.Handler) http.Handler {
 					slog.String("method", r.Method),
 					slog.String("path", r.URL.Path),
 					slog.String("remote_addr", r.RemoteAddr),
+					slog.Any("client_ip", clientIPAttr(r)),
 					slog.Int("status", ww.statusCode),
 					slog.Duration("duration", time.Since(start)),
 				)
@@ -40,3 +43,10 @@ func SlogLogger(logger *slog.Logger) func(http.Handler) http.Handler {
 		})
 	}
 }
+
+func clientIPAttr(r *http.Request) any {
+	if ip, ok := clientip.FromContext(r.Context()); ok {
+		return ip
+	}
+	return nil
+}
@@ -1,32 +1,56 @@
 package http
 
 import (
+	"expvar"
 	"log/slog"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/vadimbarashkov/medods-test-task/internal/service"
+	"github.com/vadimbarashkov/medods-test-task/pkg/clientip"
 
 	v1 "github.com/vadimbarashkov/medods-test-task/internal/http/handler/v1"
 )
 
-func NewRouter(logger *slog.Logger, authService *service.AuthService) http.Handler {
+func NewRouter(
+	logger *slog.Logger,
+	clientIPResolver *clientip.Resolver,
+	authService *service.AuthService,
+	rateLimiter *service.RateLimiter,
+	rateLimits v1.RateLimits,
+	publicURL string,
+) http.Handler {
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(clientIPResolver.Middleware)
 	r.Use(SlogLogger(logger))
 	r.Use(middleware.Recoverer)
 
-	r.Route("/api/v1", func(r chi.Router) {
+	r.Route(v1.Prefix, func(r chi.Router) {
 		r.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusOK)
 			_, _ = w.Write([]byte("ok"))
 		})
 
-		v1.RegisterAuthRoutes(r, authService)
+		v1.RegisterAuthRoutes(r, authService, rateLimiter, rateLimits)
 	})
 
+	v1.RegisterOAuthRoutes(r, authService, rateLimiter, rateLimits)
+	v1.RegisterWellKnownRoutes(r, authService, publicURL)
+
+	return r
+}
+
+// NewAdminRouter serves the runtime counters. It has no authentication, so it
+// must only be reachable from the internal network.
+func NewAdminRouter() http.Handler {
+	r := chi.NewRouter()
+
+	r.Use(middleware.Recoverer)
+
+	r.Handle("/debug/vars", expvar.Handler())
+
 	return r
 }
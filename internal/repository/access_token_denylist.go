@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AccessTokenDenylist interface {
+	Add(ctx context.Context, jti uuid.UUID, expiresAt time.Time) error
+	Contains(ctx context.Context, jti uuid.UUID) (bool, error)
+	DeleteExpired(ctx context.Context, limit int) (int64, error)
+}
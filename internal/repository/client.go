@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/vadimbarashkov/medods-test-task/internal/entity"
+)
+
+var ErrClientNotFound = errors.New("client not found")
+
+type ClientRepository interface {
+	Get(ctx context.Context, id string) (*entity.Client, error)
+}
@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"errors"
+	"net"
+
+	"github.com/vadimbarashkov/medods-test-task/internal/entity"
+)
+
+var ErrLocationNotFound = errors.New("location not found")
+
+type GeoIPLocator interface {
+	Locate(ip net.IP) (*entity.Location, error)
+}
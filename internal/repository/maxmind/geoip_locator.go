@@ -0,0 +1,80 @@
+package maxmind
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/vadimbarashkov/medods-test-task/internal/entity"
+	"github.com/vadimbarashkov/medods-test-task/internal/repository"
+)
+
+// GeoIPLocator reads locations from MaxMind format databases, e.g.
+// GeoLite2-Country and GeoLite2-ASN. Databases carrying both the country and
+// the ASN of a network work as well.
+type GeoIPLocator struct {
+	readers []*maxminddb.Reader
+}
+
+func NewGeoIPLocator(paths ...string) (*GeoIPLocator, error) {
+	l := &GeoIPLocator{}
+	for _, path := range paths {
+		r, err := maxminddb.Open(path)
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("open %s: %w", path, err)
+		}
+		l.readers = append(l.readers, r)
+	}
+	return l, nil
+}
+
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	ASN            uint   `maxminddb:"autonomous_system_number"`
+	ASOrganization string `maxminddb:"autonomous_system_organization"`
+}
+
+func (l *GeoIPLocator) Locate(ip net.IP) (*entity.Location, error) {
+	if ip == nil {
+		return nil, repository.ErrLocationNotFound
+	}
+
+	var (
+		loc   entity.Location
+		found bool
+	)
+	for _, r := range l.readers {
+		var rec record
+		_, ok, err := r.LookupNetwork(ip, &rec)
+		if err != nil {
+			return nil, fmt.Errorf("lookup %s: %w", ip, err)
+		}
+		if !ok {
+			continue
+		}
+		found = true
+		if rec.Country.ISOCode != "" {
+			loc.Country = rec.Country.ISOCode
+		}
+		if rec.ASN != 0 {
+			loc.ASN, loc.ASOrganization = rec.ASN, rec.ASOrganization
+		}
+	}
+
+	if !found {
+		return nil, repository.ErrLocationNotFound
+	}
+	return &loc, nil
+}
+
+func (l *GeoIPLocator) Close() error {
+	var errs []error
+	for _, r := range l.readers {
+		errs = append(errs, r.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const denylistPurgeInterval = time.Minute
+
+type AccessTokenDenylist struct {
+	mu        sync.RWMutex
+	entries   map[uuid.UUID]time.Time
+	lastPurge time.Time
+}
+
+func NewAccessTokenDenylist() *AccessTokenDenylist {
+	return &AccessTokenDenylist{
+		entries:   make(map[uuid.UUID]time.Time),
+		lastPurge: time.Now(),
+	}
+}
+
+func (d *AccessTokenDenylist) Add(_ context.Context, jti uuid.UUID, expiresAt time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if now := time.Now(); now.Sub(d.lastPurge) >= denylistPurgeInterval {
+		d.purge(now, 0)
+		d.lastPurge = now
+	}
+
+	if exp, ok := d.entries[jti]; !ok || expiresAt.After(exp) {
+		d.entries[jti] = expiresAt
+	}
+	return nil
+}
+
+func (d *AccessTokenDenylist) Contains(_ context.Context, jti uuid.UUID) (bool, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	exp, ok := d.entries[jti]
+	return ok && time.Now().Before(exp), nil
+}
+
+func (d *AccessTokenDenylist) DeleteExpired(_ context.Context, limit int) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.purge(time.Now(), limit), nil
+}
+
+// purge deletes up to limit expired entries, all of them if limit is zero.
+// The caller must hold the write lock.
+func (d *AccessTokenDenylist) purge(now time.Time, limit int) int64 {
+	var deleted int64
+	for id, exp := range d.entries {
+		if limit > 0 && deleted >= int64(limit) {
+			break
+		}
+		if !now.Before(exp) {
+			delete(d.entries, id)
+			deleted++
+		}
+	}
+	return deleted
+}
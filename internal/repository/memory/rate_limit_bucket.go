@@ -0,0 +1,82 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const bucketPurgeInterval = time.Minute
+
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+	fullAt    time.Time
+}
+
+// RateLimitBucketRepository keeps buckets of a single instance, so every
+// replica enforces its own limits.
+type RateLimitBucketRepository struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastPurge time.Time
+}
+
+func NewRateLimitBucketRepository() *RateLimitBucketRepository {
+	return &RateLimitBucketRepository{
+		buckets:   make(map[string]*tokenBucket),
+		lastPurge: time.Now(),
+	}
+}
+
+func (r *RateLimitBucketRepository) Take(_ context.Context, key string, rate float64, burst int) (bool, float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.lastPurge) >= bucketPurgeInterval {
+		r.purge(now, 0)
+		r.lastPurge = now
+	}
+
+	b, ok := r.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(burst), updatedAt: now}
+		r.buckets[key] = b
+	}
+
+	elapsed := max(now.Sub(b.updatedAt).Seconds(), 0)
+	b.tokens = min(float64(burst), b.tokens+elapsed*rate)
+	b.updatedAt = now
+
+	if b.tokens < 1 {
+		return false, b.tokens, nil
+	}
+
+	b.tokens--
+	b.fullAt = now.Add(time.Duration((float64(burst) - b.tokens) / rate * float64(time.Second)))
+	return true, b.tokens, nil
+}
+
+func (r *RateLimitBucketRepository) DeleteExpired(_ context.Context, limit int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.purge(time.Now(), limit), nil
+}
+
+// purge deletes up to limit full buckets, all of them if limit is zero.
+// The caller must hold the lock.
+func (r *RateLimitBucketRepository) purge(now time.Time, limit int) int64 {
+	var deleted int64
+	for key, b := range r.buckets {
+		if limit > 0 && deleted >= int64(limit) {
+			break
+		}
+		if !now.Before(b.fullAt) {
+			delete(r.buckets, key)
+			deleted++
+		}
+	}
+	return deleted
+}
@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vadimbarashkov/medods-test-task/internal/entity"
+)
+
+type NotificationOutboxRepository interface {
+	Enqueue(ctx context.Context, event entity.SecurityEvent) error
+	// Claim takes up to limit due messages, counts a delivery attempt for each
+	// and hides them from other dispatchers for lease.
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]entity.OutboxMessage, error)
+	MarkDelivered(ctx context.Context, id uuid.UUID) error
+	MarkSkipped(ctx context.Context, id uuid.UUID, reason string) error
+	MarkDead(ctx context.Context, id uuid.UUID, lastErr string) error
+	// Reschedule also records the channels the message has been delivered to,
+	// which the next attempt skips.
+	Reschedule(
+		ctx context.Context,
+		id uuid.UUID,
+		nextAttemptAt time.Time,
+		deliveredChannels []string,
+		lastErr string,
+	) error
+	DeleteCompleted(ctx context.Context, retention time.Duration, limit int) (int64, error)
+}
@@ -0,0 +1,75 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type AccessTokenDenylist struct {
+	pool *pgxpool.Pool
+}
+
+func NewAccessTokenDenylist(pool *pgxpool.Pool) *AccessTokenDenylist {
+	return &AccessTokenDenylist{pool: pool}
+}
+
+func (d *AccessTokenDenylist) Add(ctx context.Context, jti uuid.UUID, expiresAt time.Time) error {
+	query := `
+		INSERT INTO access_token_denylist (jti, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT (jti) DO UPDATE
+		SET expires_at = GREATEST(access_token_denylist.expires_at, EXCLUDED.expires_at)
+	`
+
+	if _, err := exec(ctx, d.pool, query, jti, expiresAt); err != nil {
+		return fmt.Errorf("execute query: %w", err)
+	}
+
+	return nil
+}
+
+func (d *AccessTokenDenylist) Contains(ctx context.Context, jti uuid.UUID) (bool, error) {
+	query := `
+		SELECT 1
+		FROM access_token_denylist
+		WHERE jti = $1 AND expires_at > CURRENT_TIMESTAMP
+	`
+
+	var found int
+
+	row := queryRow(ctx, d.pool, query, jti)
+	if err := row.Scan(&found); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("execute query: %w", err)
+	}
+
+	return true, nil
+}
+
+func (d *AccessTokenDenylist) DeleteExpired(ctx context.Context, limit int) (int64, error) {
+	query := `
+		DELETE FROM access_token_denylist
+		WHERE jti IN (
+			SELECT jti
+			FROM access_token_denylist
+			WHERE expires_at <= CURRENT_TIMESTAMP
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+	`
+
+	result, err := exec(ctx, d.pool, query, limit)
+	if err != nil {
+		return 0, fmt.Errorf("execute query: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
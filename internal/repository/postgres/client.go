@@ -0,0 +1,40 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/vadimbarashkov/medods-test-task/internal/entity"
+	"github.com/vadimbarashkov/medods-test-task/internal/repository"
+)
+
+type ClientRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewClientRepository(pool *pgxpool.Pool) *ClientRepository {
+	return &ClientRepository{pool: pool}
+}
+
+func (r *ClientRepository) Get(ctx context.Context, id string) (*entity.Client, error) {
+	query := `
+		SELECT id, hashed_secret, scopes, created_at
+		FROM clients
+		WHERE id = $1
+	`
+
+	var client entity.Client
+
+	row := queryRow(ctx, r.pool, query, id)
+	if err := row.Scan(&client.ID, &client.HashedSecret, &client.Scopes, &client.CreatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, repository.ErrClientNotFound
+		}
+		return nil, fmt.Errorf("execute query: %w", err)
+	}
+
+	return &client, nil
+}
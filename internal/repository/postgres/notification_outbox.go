@@ -0,0 +1,167 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/vadimbarashkov/medods-test-task/internal/entity"
+)
+
+const (
+	outboxStatusPending   = "pending"
+	outboxStatusDelivered = "delivered"
+	outboxStatusSkipped   = "skipped"
+	outboxStatusDead      = "dead"
+)
+
+type NotificationOutboxRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewNotificationOutboxRepository(pool *pgxpool.Pool) *NotificationOutboxRepository {
+	return &NotificationOutboxRepository{pool: pool}
+}
+
+func (r *NotificationOutboxRepository) Enqueue(ctx context.Context, event entity.SecurityEvent) error {
+	query := `
+		INSERT INTO notification_outbox (payload)
+		VALUES ($1)
+	`
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+
+	if _, err := exec(ctx, r.pool, query, payload); err != nil {
+		return fmt.Errorf("execute query: %w", err)
+	}
+
+	return nil
+}
+
+func (r *NotificationOutboxRepository) Claim(
+	ctx context.Context,
+	limit int,
+	lease time.Duration,
+) ([]entity.OutboxMessage, error) {
+	q := `
+		UPDATE notification_outbox
+		SET attempts = attempts + 1,
+			next_attempt_at = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id
+			FROM notification_outbox
+			WHERE status = $3 AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, payload, attempts, delivered_channels
+	`
+
+	rows, err := query(ctx, r.pool, q, limit, lease.Seconds(), outboxStatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("execute query: %w", err)
+	}
+
+	messages, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.OutboxMessage, error) {
+		var (
+			msg     entity.OutboxMessage
+			payload []byte
+		)
+		if err := row.Scan(&msg.ID, &payload, &msg.Attempts, &msg.DeliveredChannels); err != nil {
+			return msg, err
+		}
+		if err := json.Unmarshal(payload, &msg.Event); err != nil {
+			return msg, fmt.Errorf("unmarshal event: %w", err)
+		}
+		return msg, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("collect rows: %w", err)
+	}
+
+	return messages, nil
+}
+
+func (r *NotificationOutboxRepository) MarkDelivered(ctx context.Context, id uuid.UUID) error {
+	return r.complete(ctx, id, outboxStatusDelivered, "")
+}
+
+func (r *NotificationOutboxRepository) MarkSkipped(ctx context.Context, id uuid.UUID, reason string) error {
+	return r.complete(ctx, id, outboxStatusSkipped, reason)
+}
+
+func (r *NotificationOutboxRepository) MarkDead(ctx context.Context, id uuid.UUID, lastErr string) error {
+	return r.complete(ctx, id, outboxStatusDead, lastErr)
+}
+
+func (r *NotificationOutboxRepository) complete(ctx context.Context, id uuid.UUID, status, lastErr string) error {
+	query := `
+		UPDATE notification_outbox
+		SET status = $2, last_error = NULLIF($3, '')
+		WHERE id = $1
+	`
+
+	if _, err := exec(ctx, r.pool, query, id, status, lastErr); err != nil {
+		return fmt.Errorf("execute query: %w", err)
+	}
+
+	return nil
+}
+
+func (r *NotificationOutboxRepository) Reschedule(
+	ctx context.Context,
+	id uuid.UUID,
+	nextAttemptAt time.Time,
+	deliveredChannels []string,
+	lastErr string,
+) error {
+	query := `
+		UPDATE notification_outbox
+		SET next_attempt_at = $2, delivered_channels = $3, last_error = $4
+		WHERE id = $1
+	`
+
+	if deliveredChannels == nil {
+		deliveredChannels = []string{}
+	}
+
+	if _, err := exec(ctx, r.pool, query, id, nextAttemptAt, deliveredChannels, lastErr); err != nil {
+		return fmt.Errorf("execute query: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteCompleted deletes up to limit delivered or skipped messages older than
+// retention. Dead messages are kept for inspection.
+func (r *NotificationOutboxRepository) DeleteCompleted(
+	ctx context.Context,
+	retention time.Duration,
+	limit int,
+) (int64, error) {
+	query := `
+		DELETE FROM notification_outbox
+		WHERE id IN (
+			SELECT id
+			FROM notification_outbox
+			WHERE status IN ($3, $4) AND updated_at < CURRENT_TIMESTAMP - $1 * INTERVAL '1 second'
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+	`
+
+	result, err := exec(ctx, r.pool, query, retention.Seconds(), limit, outboxStatusDelivered, outboxStatusSkipped)
+	if err != nil {
+		return 0, fmt.Errorf("execute query: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
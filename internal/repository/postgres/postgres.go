@@ -28,6 +28,13 @@ func exec(ctx context.Context, pool *pgxpool.Pool, query string, args ...any) (p
 	return pool.Exec(ctx, query, args...)
 }
 
+func query(ctx context.Context, pool *pgxpool.Pool, query string, args ...any) (pgx.Rows, error) {
+	if tx, ok := txFromContext(ctx); ok {
+		return tx.Query(ctx, query, args...)
+	}
+	return pool.Query(ctx, query, args...)
+}
+
 func queryRow(ctx context.Context, pool *pgxpool.Pool, query string, args ...any) pgx.Row {
 	if tx, ok := txFromContext(ctx); ok {
 		return tx.QueryRow(ctx, query, args...)
@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RateLimitBucketRepository shares buckets between replicas. The database
+// clock is used for refills, so replica clocks do not have to agree.
+type RateLimitBucketRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRateLimitBucketRepository(pool *pgxpool.Pool) *RateLimitBucketRepository {
+	return &RateLimitBucketRepository{pool: pool}
+}
+
+func (r *RateLimitBucketRepository) Take(ctx context.Context, key string, rate float64, burst int) (bool, float64, error) {
+	refillQuery := `
+		INSERT INTO rate_limit_buckets AS b (key, tokens, updated_at, full_at)
+		VALUES ($1, $3, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT (key) DO UPDATE
+		SET tokens = LEAST(
+				$3,
+				b.tokens + GREATEST(EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - b.updated_at), 0) * $2
+			),
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING tokens
+	`
+
+	var tokens float64
+
+	row := queryRow(ctx, r.pool, refillQuery, key, rate, float64(burst))
+	if err := row.Scan(&tokens); err != nil {
+		return false, 0, fmt.Errorf("execute refill query: %w", err)
+	}
+
+	// The row lock makes concurrent takes of the last token serialize here,
+	// only one of them matches tokens >= 1.
+	takeQuery := `
+		UPDATE rate_limit_buckets
+		SET tokens = tokens - 1,
+			full_at = CURRENT_TIMESTAMP + ($3 - tokens + 1) / $2 * INTERVAL '1 second'
+		WHERE key = $1 AND tokens >= 1
+		RETURNING tokens
+	`
+
+	row = queryRow(ctx, r.pool, takeQuery, key, rate, float64(burst))
+	if err := row.Scan(&tokens); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, tokens, nil
+		}
+		return false, 0, fmt.Errorf("execute take query: %w", err)
+	}
+
+	return true, tokens, nil
+}
+
+func (r *RateLimitBucketRepository) DeleteExpired(ctx context.Context, limit int) (int64, error) {
+	query := `
+		DELETE FROM rate_limit_buckets
+		WHERE key IN (
+			SELECT key
+			FROM rate_limit_buckets
+			WHERE full_at <= CURRENT_TIMESTAMP
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+	`
+
+	result, err := exec(ctx, r.pool, query, limit)
+	if err != nil {
+		return 0, fmt.Errorf("execute query: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/vadimbarashkov/medods-test-task/internal/entity"
 	"github.com/vadimbarashkov/medods-test-task/internal/repository"
 )
 
@@ -20,13 +22,46 @@ func NewRefreshTokenRepository(pool *pgxpool.Pool) *RefreshTokenRepository {
 	return &RefreshTokenRepository{pool: pool}
 }
 
-func (r *RefreshTokenRepository) Save(ctx context.Context, userID, jti uuid.UUID, hashedToken string) error {
+func (r *RefreshTokenRepository) Save(ctx context.Context, token *entity.RefreshToken) error {
 	query := `
-		INSERT INTO refresh_tokens (user_id, jti, hashed_token)
-		VALUES ($1, $2, $3)
+		INSERT INTO refresh_tokens (
+			user_id, jti, family_id, parent_jti, access_jti, access_expires_at, hashed_token, selector,
+			client_id, scopes, audiences, client_ip, user_agent, session_started_at, expires_at
+		)
+		VALUES (
+			$1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), NULLIF($9, ''), COALESCE($10::TEXT[], '{}'),
+			COALESCE($11::TEXT[], '{}'), $12, $13, COALESCE($14::TIMESTAMPTZ, CURRENT_TIMESTAMP), $15
+		)
 	`
 
-	if _, err := exec(ctx, r.pool, query, userID, jti, hashedToken); err != nil {
+	var accessExpiresAt, sessionStartedAt *time.Time
+	if !token.AccessExpiresAt.IsZero() {
+		accessExpiresAt = &token.AccessExpiresAt
+	}
+	if !token.SessionStartedAt.IsZero() {
+		sessionStartedAt = &token.SessionStartedAt
+	}
+
+	if _, err := exec(
+		ctx,
+		r.pool,
+		query,
+		token.UserID,
+		token.JTI,
+		token.FamilyID,
+		token.ParentJTI,
+		token.AccessJTI,
+		accessExpiresAt,
+		token.HashedToken,
+		token.Selector,
+		token.ClientID,
+		token.Scopes,
+		token.Audiences,
+		token.ClientIP,
+		token.UserAgent,
+		sessionStartedAt,
+		token.ExpiresAt,
+	); err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolationErrCode {
 			return repository.ErrRefreshTokenExists
@@ -37,34 +72,68 @@ func (r *RefreshTokenRepository) Save(ctx context.Context, userID, jti uuid.UUID
 	return nil
 }
 
-func (r *RefreshTokenRepository) Get(ctx context.Context, userID, jti uuid.UUID) (string, bool, error) {
+func (r *RefreshTokenRepository) Get(ctx context.Context, userID, jti uuid.UUID) (*entity.RefreshToken, error) {
+	return r.get(ctx, "user_id = $1 AND jti = $2", userID, jti)
+}
+
+func (r *RefreshTokenRepository) GetBySelector(ctx context.Context, selector string) (*entity.RefreshToken, error) {
+	return r.get(ctx, "selector = $1", selector)
+}
+
+func (r *RefreshTokenRepository) get(ctx context.Context, where string, args ...any) (*entity.RefreshToken, error) {
 	query := `
-		SELECT hashed_token, revoked
+		SELECT
+			user_id, jti, family_id, parent_jti, access_jti, access_expires_at, hashed_token,
+			COALESCE(selector, ''), revoked,
+			COALESCE(client_id, ''), scopes, audiences, COALESCE(client_ip, ''), COALESCE(user_agent, ''),
+			session_started_at, created_at, expires_at
 		FROM refresh_tokens
-		WHERE user_id = $1 AND jti = $2
-	`
+		WHERE ` + where
 
 	var (
-		hashedToken string
-		revoked     bool
+		token           entity.RefreshToken
+		accessJTI       uuid.NullUUID
+		accessExpiresAt *time.Time
 	)
 
-	row := queryRow(ctx, r.pool, query, userID, jti)
-	if err := row.Scan(&hashedToken, &revoked); err != nil {
+	row := queryRow(ctx, r.pool, query, args...)
+	if err := row.Scan(
+		&token.UserID,
+		&token.JTI,
+		&token.FamilyID,
+		&token.ParentJTI,
+		&accessJTI,
+		&accessExpiresAt,
+		&token.HashedToken,
+		&token.Selector,
+		&token.Revoked,
+		&token.ClientID,
+		&token.Scopes,
+		&token.Audiences,
+		&token.ClientIP,
+		&token.UserAgent,
+		&token.SessionStartedAt,
+		&token.CreatedAt,
+		&token.ExpiresAt,
+	); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return "", false, repository.ErrRefreshTokenNotFound
+			return nil, repository.ErrRefreshTokenNotFound
 		}
-		return "", false, fmt.Errorf("execute query: %w", err)
+		return nil, fmt.Errorf("execute query: %w", err)
 	}
 
-	return hashedToken, revoked, nil
+	token.AccessJTI = accessJTI.UUID
+	if accessExpiresAt != nil {
+		token.AccessExpiresAt = *accessExpiresAt
+	}
+	return &token, nil
 }
 
 func (r *RefreshTokenRepository) Revoke(ctx context.Context, userID, jti uuid.UUID) error {
 	query := `
 		UPDATE refresh_tokens
 		SET revoked = TRUE
-		WHERE user_id = $1 AND jti = $2
+		WHERE user_id = $1 AND jti = $2 AND revoked = FALSE
 	`
 
 	result, err := exec(ctx, r.pool, query, userID, jti)
@@ -79,6 +148,133 @@ func (r *RefreshTokenRepository) Revoke(ctx context.Context, userID, jti uuid.UU
 	return nil
 }
 
+func (r *RefreshTokenRepository) RevokeFamily(
+	ctx context.Context,
+	userID, familyID uuid.UUID,
+) ([]entity.AccessTokenRef, error) {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked = TRUE
+		WHERE user_id = $1 AND family_id = $2 AND revoked = FALSE
+		RETURNING access_jti, access_expires_at
+	`
+
+	accessTokens, err := r.revokeMany(ctx, query, userID, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(accessTokens) == 0 {
+		return nil, repository.ErrRefreshTokenNotFound
+	}
+
+	return accessTokens, nil
+}
+
+func (r *RefreshTokenRepository) RevokeAll(ctx context.Context, userID uuid.UUID) ([]entity.AccessTokenRef, error) {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked = TRUE
+		WHERE user_id = $1 AND revoked = FALSE
+		RETURNING access_jti, access_expires_at
+	`
+
+	return r.revokeMany(ctx, query, userID)
+}
+
+func (r *RefreshTokenRepository) ListSessions(ctx context.Context, userID uuid.UUID) ([]entity.Session, error) {
+	q := `
+		SELECT family_id, COALESCE(client_ip, ''), COALESCE(user_agent, ''), session_started_at, created_at
+		FROM refresh_tokens
+		WHERE user_id = $1 AND revoked = FALSE AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY created_at DESC
+	`
+
+	rows, err := query(ctx, r.pool, q, userID)
+	if err != nil {
+		return nil, fmt.Errorf("execute query: %w", err)
+	}
+
+	sessions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.Session, error) {
+		var s entity.Session
+		err := row.Scan(&s.ID, &s.ClientIP, &s.UserAgent, &s.CreatedAt, &s.LastRefreshedAt)
+		return s, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("collect rows: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// DeleteExpired deletes up to limit tokens that expired more than retention
+// ago and reports how many rows were deleted. Revoked tokens are kept until
+// then too, replaying one has to find its row for reuse to be detected.
+func (r *RefreshTokenRepository) DeleteExpired(ctx context.Context, retention time.Duration, limit int) (int64, error) {
+	query := `
+		DELETE FROM refresh_tokens
+		WHERE id IN (
+			SELECT id
+			FROM refresh_tokens
+			WHERE expires_at < CURRENT_TIMESTAMP - $1 * INTERVAL '1 second'
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+	`
+
+	result, err := exec(ctx, r.pool, query, retention.Seconds(), limit)
+	if err != nil {
+		return 0, fmt.Errorf("execute query: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// BackfillExpiresAt sets the expiration of tokens issued before they had one
+// to ttl after they were issued and reports how many rows were updated.
+func (r *RefreshTokenRepository) BackfillExpiresAt(ctx context.Context, ttl time.Duration) (int64, error) {
+	query := `
+		UPDATE refresh_tokens
+		SET expires_at = created_at + $1 * INTERVAL '1 second'
+		WHERE expires_at IS NULL
+	`
+
+	result, err := exec(ctx, r.pool, query, ttl.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("execute query: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+func (r *RefreshTokenRepository) revokeMany(ctx context.Context, q string, args ...any) ([]entity.AccessTokenRef, error) {
+	rows, err := query(ctx, r.pool, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("execute query: %w", err)
+	}
+
+	accessTokens, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.AccessTokenRef, error) {
+		var (
+			accessJTI       uuid.NullUUID
+			accessExpiresAt *time.Time
+		)
+		if err := row.Scan(&accessJTI, &accessExpiresAt); err != nil {
+			return entity.AccessTokenRef{}, err
+		}
+
+		ref := entity.AccessTokenRef{JTI: accessJTI.UUID}
+		if accessExpiresAt != nil {
+			ref.ExpiresAt = *accessExpiresAt
+		}
+		return ref, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("collect rows: %w", err)
+	}
+
+	return accessTokens, nil
+}
+
 func (r *RefreshTokenRepository) Transaction(ctx context.Context, fn func(context.Context) error) error {
 	tx, err := r.pool.Begin(ctx)
 	if err != nil {
@@ -0,0 +1,58 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/vadimbarashkov/medods-test-task/internal/repository"
+)
+
+type UsedRevokeTokenRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewUsedRevokeTokenRepository(pool *pgxpool.Pool) *UsedRevokeTokenRepository {
+	return &UsedRevokeTokenRepository{pool: pool}
+}
+
+func (r *UsedRevokeTokenRepository) Use(ctx context.Context, jti uuid.UUID, expiresAt time.Time) error {
+	query := `
+		INSERT INTO used_revoke_tokens (jti, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT (jti) DO NOTHING
+	`
+
+	result, err := exec(ctx, r.pool, query, jti, expiresAt)
+	if err != nil {
+		return fmt.Errorf("execute query: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return repository.ErrRevokeTokenUsed
+	}
+
+	return nil
+}
+
+func (r *UsedRevokeTokenRepository) DeleteExpired(ctx context.Context, limit int) (int64, error) {
+	query := `
+		DELETE FROM used_revoke_tokens
+		WHERE jti IN (
+			SELECT jti
+			FROM used_revoke_tokens
+			WHERE expires_at <= CURRENT_TIMESTAMP
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+	`
+
+	result, err := exec(ctx, r.pool, query, limit)
+	if err != nil {
+		return 0, fmt.Errorf("execute query: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/vadimbarashkov/medods-test-task/internal/entity"
+	"github.com/vadimbarashkov/medods-test-task/internal/repository"
+)
+
+// UserDirectory reads users from a table owned by another service,
+// so the table and column names are configurable.
+type UserDirectory struct {
+	pool  *pgxpool.Pool
+	query string
+}
+
+type UserDirectoryParams struct {
+	Table       string
+	IDColumn    string
+	EmailColumn string
+	// The columns below are optional.
+	PhoneColumn          string
+	TelegramChatIDColumn string
+	// LocaleColumn selects the notification language, without it the default
+	// locale is used.
+	LocaleColumn string
+	// RolesColumn is a TEXT[] column, without it tokens carry no roles.
+	RolesColumn string
+}
+
+func NewUserDirectory(pool *pgxpool.Pool, p UserDirectoryParams) *UserDirectory {
+	// Telegram chat IDs are usually stored as BIGINT.
+	query := fmt.Sprintf(
+		"SELECT %s, %s, %s::TEXT, %s, %s::TEXT[] FROM %s WHERE %s = $1",
+		pgx.Identifier{p.EmailColumn}.Sanitize(),
+		optionalColumn(p.PhoneColumn),
+		optionalColumn(p.TelegramChatIDColumn),
+		optionalColumn(p.LocaleColumn),
+		optionalColumn(p.RolesColumn),
+		pgx.Identifier{p.Table}.Sanitize(),
+		pgx.Identifier{p.IDColumn}.Sanitize(),
+	)
+	return &UserDirectory{pool: pool, query: query}
+}
+
+func optionalColumn(name string) string {
+	if name == "" {
+		return "NULL"
+	}
+	return pgx.Identifier{name}.Sanitize()
+}
+
+func (d *UserDirectory) GetUser(ctx context.Context, userID uuid.UUID) (*entity.User, error) {
+	user := &entity.User{ID: userID}
+
+	var email, phone, telegramChatID, locale *string
+
+	row := queryRow(ctx, d.pool, d.query, userID)
+	if err := row.Scan(&email, &phone, &telegramChatID, &locale, &user.Roles); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, repository.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("execute query: %w", err)
+	}
+
+	if email != nil {
+		user.Email = *email
+	}
+	if phone != nil {
+		user.Phone = *phone
+	}
+	if telegramChatID != nil {
+		user.TelegramChatID = *telegramChatID
+	}
+	if locale != nil {
+		user.Locale = *locale
+	}
+
+	return user, nil
+}
@@ -0,0 +1,14 @@
+package repository
+
+import "context"
+
+// RateLimitBucketRepository stores token buckets for rate limiting.
+type RateLimitBucketRepository interface {
+	// Take refills the key bucket at rate tokens per second up to burst and
+	// takes a token from it if there is one. A missing bucket is full. It
+	// returns whether a token was taken and how many are left.
+	Take(ctx context.Context, key string, rate float64, burst int) (bool, float64, error)
+	// DeleteExpired deletes up to limit buckets that have refilled completely,
+	// which are equivalent to missing ones.
+	DeleteExpired(ctx context.Context, limit int) (int64, error)
+}
@@ -3,8 +3,10 @@ package repository
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/vadimbarashkov/medods-test-task/internal/entity"
 )
 
 var (
@@ -13,8 +15,16 @@ var (
 )
 
 type RefreshTokenRepository interface {
-	Save(ctx context.Context, userID, jti uuid.UUID, hashedToken string) error
-	Get(ctx context.Context, userID, jti uuid.UUID) (string, bool, error)
+	Save(ctx context.Context, token *entity.RefreshToken) error
+	Get(ctx context.Context, userID, jti uuid.UUID) (*entity.RefreshToken, error)
+	GetBySelector(ctx context.Context, selector string) (*entity.RefreshToken, error)
 	Revoke(ctx context.Context, userID, jti uuid.UUID) error
+	// RevokeFamily and RevokeAll return the access tokens paired with the
+	// refresh tokens they revoked.
+	RevokeFamily(ctx context.Context, userID, familyID uuid.UUID) ([]entity.AccessTokenRef, error)
+	RevokeAll(ctx context.Context, userID uuid.UUID) ([]entity.AccessTokenRef, error)
+	ListSessions(ctx context.Context, userID uuid.UUID) ([]entity.Session, error)
+	DeleteExpired(ctx context.Context, retention time.Duration, limit int) (int64, error)
+	BackfillExpiresAt(ctx context.Context, ttl time.Duration) (int64, error)
 	Transaction(ctx context.Context, fn func(context.Context) error) error
 }
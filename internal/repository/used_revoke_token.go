@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrRevokeTokenUsed = errors.New("revoke token used")
+
+// UsedRevokeTokenRepository records the session revoke tokens that were
+// redeemed, so that each of them works once.
+type UsedRevokeTokenRepository interface {
+	// Use records jti until expiresAt, it returns ErrRevokeTokenUsed when jti
+	// is recorded already.
+	Use(ctx context.Context, jti uuid.UUID, expiresAt time.Time) error
+	DeleteExpired(ctx context.Context, limit int) (int64, error)
+}
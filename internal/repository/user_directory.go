@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/vadimbarashkov/medods-test-task/internal/entity"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+type UserDirectory interface {
+	GetUser(ctx context.Context, userID uuid.UUID) (*entity.User, error)
+}
@@ -0,0 +1,88 @@
+package userservice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/vadimbarashkov/medods-test-task/internal/entity"
+	"github.com/vadimbarashkov/medods-test-task/internal/repository"
+)
+
+const userIDPlaceholder = "{user_id}"
+
+// UserDirectory looks users up through the HTTP API of the user service.
+// The URL template must contain the {user_id} placeholder, e.g.
+// http://user-service/api/v1/users/{user_id}.
+type UserDirectory struct {
+	client      *http.Client
+	urlTemplate string
+	token       string
+}
+
+type UserDirectoryParams struct {
+	Client      *http.Client
+	URLTemplate string
+	// Token is sent as a bearer token when not empty.
+	Token string
+}
+
+func NewUserDirectory(p UserDirectoryParams) *UserDirectory {
+	return &UserDirectory{
+		client:      p.Client,
+		urlTemplate: p.URLTemplate,
+		token:       p.Token,
+	}
+}
+
+type userResponse struct {
+	Email          string   `json:"email"`
+	Phone          string   `json:"phone"`
+	TelegramChatID string   `json:"telegram_chat_id"`
+	Locale         string   `json:"locale"`
+	Roles          []string `json:"roles"`
+}
+
+func (d *UserDirectory) GetUser(ctx context.Context, userID uuid.UUID) (*entity.User, error) {
+	u := strings.ReplaceAll(d.urlTemplate, userIDPlaceholder, url.PathEscape(userID.String()))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if d.token != "" {
+		req.Header.Set("Authorization", "Bearer "+d.token)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, repository.ErrUserNotFound
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var body userResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	return &entity.User{
+		ID:             userID,
+		Email:          body.Email,
+		Phone:          body.Phone,
+		TelegramChatID: body.TelegramChatID,
+		Locale:         body.Locale,
+		Roles:          body.Roles,
+	}, nil
+}
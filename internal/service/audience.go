@@ -0,0 +1,60 @@
+package service
+
+import (
+	"maps"
+	"slices"
+	"time"
+)
+
+// AudienceTTL overrides the token lifetimes of an audience. Zero values keep
+// the default lifetimes.
+type AudienceTTL struct {
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+// grantAudiences returns the requested audiences if every one of them is
+// configured. Tokens are issued without an audience when none are requested.
+func (s *AuthService) grantAudiences(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return nil, nil
+	}
+	return narrow(slices.Collect(maps.Keys(s.audiences)), requested, ErrInvalidAudience)
+}
+
+// tokenTTLs returns the lifetimes of the access and refresh tokens issued for
+// the audiences. A token has to suit every audience, so the shortest wins.
+func (s *AuthService) tokenTTLs(audiences []string) (time.Duration, time.Duration) {
+	if len(audiences) == 0 {
+		return s.accessTokenTTL, s.refreshTokenTTL
+	}
+
+	var accessTTL, refreshTTL time.Duration
+	for i, aud := range audiences {
+		ttl := s.audiences[aud]
+		audAccessTTL, audRefreshTTL := s.accessTokenTTL, s.refreshTokenTTL
+		if ttl.AccessTTL > 0 {
+			audAccessTTL = ttl.AccessTTL
+		}
+		if ttl.RefreshTTL > 0 {
+			audRefreshTTL = ttl.RefreshTTL
+		}
+
+		if i == 0 || audAccessTTL < accessTTL {
+			accessTTL = audAccessTTL
+		}
+		if i == 0 || audRefreshTTL < refreshTTL {
+			refreshTTL = audRefreshTTL
+		}
+	}
+	return accessTTL, refreshTTL
+}
+
+// maxAccessTokenTTL returns the longest lifetime an access token can have.
+func maxAccessTokenTTL(defaultTTL time.Duration, audiences map[string]AudienceTTL) time.Duration {
+	maxTTL := defaultTTL
+	for _, ttl := range audiences {
+		maxTTL = max(maxTTL, ttl.AccessTTL)
+	}
+	return maxTTL
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAuthService_tokenTTLs(t *testing.T) {
+	s := &AuthService{
+		accessTokenTTL:  15 * time.Minute,
+		refreshTokenTTL: time.Hour,
+		audiences: map[string]AudienceTTL{
+			"auth-service": {},
+			"billing":      {AccessTTL: 5 * time.Minute, RefreshTTL: 30 * time.Minute},
+			"reports":      {AccessTTL: 30 * time.Minute},
+			"mobile":       {RefreshTTL: 24 * time.Hour},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		audiences   []string
+		wantAccess  time.Duration
+		wantRefresh time.Duration
+	}{
+		{
+			name:        "no audience",
+			wantAccess:  15 * time.Minute,
+			wantRefresh: time.Hour,
+		},
+		{
+			name:        "audience without overrides",
+			audiences:   []string{"auth-service"},
+			wantAccess:  15 * time.Minute,
+			wantRefresh: time.Hour,
+		},
+		{
+			name:        "audience with overrides",
+			audiences:   []string{"billing"},
+			wantAccess:  5 * time.Minute,
+			wantRefresh: 30 * time.Minute,
+		},
+		{
+			name:        "partial overrides keep the defaults",
+			audiences:   []string{"reports"},
+			wantAccess:  30 * time.Minute,
+			wantRefresh: time.Hour,
+		},
+		{
+			name:        "shortest wins",
+			audiences:   []string{"reports", "billing"},
+			wantAccess:  5 * time.Minute,
+			wantRefresh: 30 * time.Minute,
+		},
+		{
+			name:        "longer overrides are capped by the defaults of other audiences",
+			audiences:   []string{"mobile", "reports"},
+			wantAccess:  15 * time.Minute,
+			wantRefresh: time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			access, refresh := s.tokenTTLs(tt.audiences)
+			if access != tt.wantAccess || refresh != tt.wantRefresh {
+				t.Errorf("tokenTTLs() = %v, %v, want %v, %v", access, refresh, tt.wantAccess, tt.wantRefresh)
+			}
+		})
+	}
+}
+
+func TestAuthService_grantAudiences(t *testing.T) {
+	s := &AuthService{
+		audiences: map[string]AudienceTTL{"auth-service": {}, "billing": {}},
+	}
+
+	tests := []struct {
+		name      string
+		requested []string
+		want      []string
+		wantErr   error
+	}{
+		{name: "none requested", want: nil},
+		{name: "known", requested: []string{"billing", "billing"}, want: []string{"billing"}},
+		{name: "unknown", requested: []string{"billing", "payroll"}, wantErr: ErrInvalidAudience},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.grantAudiences(tt.requested)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("grantAudiences() error = %v, want %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("grantAudiences() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxAccessTokenTTL(t *testing.T) {
+	got := maxAccessTokenTTL(15*time.Minute, map[string]AudienceTTL{
+		"billing": {AccessTTL: 5 * time.Minute},
+		"reports": {AccessTTL: 30 * time.Minute},
+		"mobile":  {RefreshTTL: 24 * time.Hour},
+	})
+	if got != 30*time.Minute {
+		t.Errorf("maxAccessTokenTTL() = %v, want 30m", got)
+	}
+}
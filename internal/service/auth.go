@@ -5,79 +5,181 @@ import (
 	"crypto/sha256"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net"
+	"slices"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/vadimbarashkov/medods-test-task/internal/entity"
 	"github.com/vadimbarashkov/medods-test-task/internal/repository"
-	"github.com/vadimbarashkov/medods-test-task/pkg/notifier"
+	"github.com/vadimbarashkov/medods-test-task/internal/signing"
+	"github.com/vadimbarashkov/medods-test-task/pkg/jwk"
 	"golang.org/x/crypto/bcrypt"
 )
 
-const tokenIssuer = "auth-service"
-
-var ErrInvalidToken = errors.New("invalid token")
+var (
+	ErrInvalidToken      = errors.New("invalid token")
+	ErrTokenReused       = errors.New("token reused")
+	ErrTokenPairMismatch = errors.New("token pair mismatch")
+	ErrTokenRevoked      = errors.New("token revoked")
+	ErrClientIPChanged   = errors.New("client ip changed")
+	ErrInvalidClient     = errors.New("invalid client")
+	ErrInvalidScope      = errors.New("invalid scope")
+	ErrInvalidAudience   = errors.New("invalid audience")
+	ErrClientMismatch    = errors.New("token issued to another client")
+	// ErrAccessTokenRevocationUnsupported is returned when access tokens
+	// cannot be revoked because the denylist is disabled.
+	ErrAccessTokenRevocationUnsupported = errors.New("access token revocation unsupported")
+)
 
 type AuthService struct {
-	accessTokenSecret  []byte
-	accessTokenTTL     time.Duration
-	refreshTokenSecret []byte
-	refreshTokenTTL    time.Duration
-	refreshTokenRepo   repository.RefreshTokenRepository
-	emailNotifier      notifier.EmailNotifier
+	issuer string
+	// audience is optional, when set VerifyAccessToken only accepts access
+	// tokens issued for it.
+	audience  string
+	audiences map[string]AudienceTTL
+	// maxAccessTokenTTL is the longest lifetime of an access token over
+	// all audiences.
+	maxAccessTokenTTL time.Duration
+	accessKeyring     *signing.Keyring
+	accessTokenTTL    time.Duration
+	refreshKeyring    *signing.Keyring
+	refreshTokenTTL   time.Duration
+	// refreshTokenFormat is RefreshTokenFormatJWT or RefreshTokenFormatOpaque,
+	// tokens of both formats are accepted whatever it is.
+	refreshTokenFormat string
+	revokeTokenTTL     time.Duration
+	reuseDetection     bool
+	ipPolicy           IPPolicy
+	// geoIP is optional, without it IP changes are judged by the IPs alone.
+	geoIP            repository.GeoIPLocator
+	refreshTokenRepo repository.RefreshTokenRepository
+	clientRepo       repository.ClientRepository
+	// userDirectory is optional, without it tokens carry no roles.
+	userDirectory repository.UserDirectory
+	// accessDenylist is optional, when nil access tokens stay valid until they expire.
+	accessDenylist      repository.AccessTokenDenylist
+	usedRevokeTokenRepo repository.UsedRevokeTokenRepository
+	outboxRepo          repository.NotificationOutboxRepository
+	logger              *slog.Logger
 }
 
 type AuthServiceParams struct {
-	AccessTokenSecret  []byte
-	AccessTokenTTL     time.Duration
-	RefreshTokenSecret []byte
-	RefreshTokenTTL    time.Duration
-	RefreshTokenRepo   repository.RefreshTokenRepository
-	EmailNotifier      notifier.EmailNotifier
+	Issuer   string
+	Audience string
+	// Audiences tokens can be issued for, with their lifetime overrides.
+	Audiences       map[string]AudienceTTL
+	AccessKeyring   *signing.Keyring
+	AccessTokenTTL  time.Duration
+	RefreshKeyring  *signing.Keyring
+	RefreshTokenTTL time.Duration
+	// RefreshTokenFormat is the format of new refresh tokens, one of
+	// RefreshTokenFormatJWT or RefreshTokenFormatOpaque.
+	RefreshTokenFormat  string
+	RevokeTokenTTL      time.Duration
+	ReuseDetection      bool
+	IPPolicy            IPPolicy
+	GeoIP               repository.GeoIPLocator
+	RefreshTokenRepo    repository.RefreshTokenRepository
+	ClientRepo          repository.ClientRepository
+	UserDirectory       repository.UserDirectory
+	AccessDenylist      repository.AccessTokenDenylist
+	UsedRevokeTokenRepo repository.UsedRevokeTokenRepository
+	OutboxRepo          repository.NotificationOutboxRepository
+	Logger              *slog.Logger
 }
 
 func NewAuthService(p AuthServiceParams) *AuthService {
 	return &AuthService{
-		accessTokenSecret:  p.AccessTokenSecret,
-		accessTokenTTL:     p.AccessTokenTTL,
-		refreshTokenSecret: p.RefreshTokenSecret,
-		refreshTokenTTL:    p.RefreshTokenTTL,
-		refreshTokenRepo:   p.RefreshTokenRepo,
-		emailNotifier:      p.EmailNotifier,
+		issuer:              p.Issuer,
+		audience:            p.Audience,
+		audiences:           p.Audiences,
+		maxAccessTokenTTL:   maxAccessTokenTTL(p.AccessTokenTTL, p.Audiences),
+		accessKeyring:       p.AccessKeyring,
+		accessTokenTTL:      p.AccessTokenTTL,
+		refreshKeyring:      p.RefreshKeyring,
+		refreshTokenTTL:     p.RefreshTokenTTL,
+		refreshTokenFormat:  p.RefreshTokenFormat,
+		revokeTokenTTL:      p.RevokeTokenTTL,
+		reuseDetection:      p.ReuseDetection,
+		ipPolicy:            p.IPPolicy,
+		geoIP:               p.GeoIP,
+		refreshTokenRepo:    p.RefreshTokenRepo,
+		clientRepo:          p.ClientRepo,
+		userDirectory:       p.UserDirectory,
+		accessDenylist:      p.AccessDenylist,
+		usedRevokeTokenRepo: p.UsedRevokeTokenRepo,
+		outboxRepo:          p.OutboxRepo,
+		logger:              p.Logger,
 	}
 }
 
 type generateTokenParams struct {
-	userID   uuid.UUID
-	clientIP net.IP
-	ttl      time.Duration
-	jti      uuid.UUID
-	secret   []byte
+	userID    uuid.UUID
+	clientID  string
+	clientIP  net.IP
+	scopes    []string
+	roles     []string
+	audiences []string
+	ttl       time.Duration
+	jti       uuid.UUID
+	accessJTI uuid.UUID
+	keyring   *signing.Keyring
 }
 
 func (s *AuthService) generateToken(p generateTokenParams) (string, error) {
 	claims := &entity.TokenClaims{
-		UserID:   p.userID.String(),
-		ClientIP: p.clientIP.String(),
+		UserID:          p.userID.String(),
+		ClientIP:        p.clientIP.String(),
+		AuthorizedParty: p.clientID,
+		Scope:           FormatScope(p.scopes),
+		Roles:           p.roles,
 		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    tokenIssuer,
+			Issuer:    s.issuer,
+			Subject:   p.userID.String(),
+			Audience:  p.audiences,
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(p.ttl)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ID:        p.jti.String(),
 		},
 	}
 
-	return jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString(p.secret)
+	if p.accessJTI != uuid.Nil {
+		claims.AccessJTI = p.accessJTI.String()
+	}
+
+	key := p.keyring.Active()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.SignKey())
 }
 
-func (s *AuthService) parseToken(token string, secret []byte) (*entity.TokenClaims, error) {
+func (s *AuthService) parseToken(
+	token string,
+	keyring *signing.Keyring,
+	opts ...jwt.ParserOption,
+) (*entity.TokenClaims, error) {
 	parsedToken, err := jwt.ParseWithClaims(token, &entity.TokenClaims{}, func(t *jwt.Token) (any, error) {
-		return secret, nil
-	})
+		// Tokens issued before key rotation was introduced carry no kid, they
+		// are not matched against the active key.
+		kid, ok := t.Header["kid"].(string)
+		if !ok {
+			return nil, signing.ErrKeyNotFound
+		}
+		key, ok := keyring.Lookup(kid)
+		if !ok {
+			return nil, signing.ErrKeyNotFound
+		}
+		if t.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+		}
+		return key.VerifyKey(), nil
+	}, opts...)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
 	}
 
 	claims, ok := parsedToken.Claims.(*entity.TokenClaims)
@@ -87,6 +189,32 @@ func (s *AuthService) parseToken(token string, secret []byte) (*entity.TokenClai
 	return claims, nil
 }
 
+func (s *AuthService) Issuer() string {
+	return s.issuer
+}
+
+// SigningAlgorithms returns the algorithms of the access token keys in use.
+func (s *AuthService) SigningAlgorithms() []string {
+	var algs []string
+	for _, k := range s.accessKeyring.Keys() {
+		if alg := k.Method.Alg(); !slices.Contains(algs, alg) {
+			algs = append(algs, alg)
+		}
+	}
+	slices.Sort(algs)
+	return algs
+}
+
+func (s *AuthService) JWKS() jwk.Set {
+	set := jwk.Set{Keys: []jwk.Key{}}
+	for _, k := range s.accessKeyring.Keys() {
+		if key, ok := k.JWK(); ok {
+			set.Keys = append(set.Keys, key)
+		}
+	}
+	return set
+}
+
 func (s *AuthService) hashToken(token string) (string, error) {
 	sha := sha256.Sum256([]byte(token))
 	bytes, err := bcrypt.GenerateFromPassword(sha[:], bcrypt.DefaultCost)
@@ -98,120 +226,695 @@ func (s *AuthService) checkTokenHash(token, hashedToken string) bool {
 	return bcrypt.CompareHashAndPassword([]byte(hashedToken), sha[:]) == nil
 }
 
-func (s *AuthService) IssueTokens(ctx context.Context, userID uuid.UUID, clientIP net.IP) (string, string, error) {
+type IssuedTokens struct {
+	AccessToken  string
+	RefreshToken string
+	Scopes       []string
+	// ExpiresIn is the lifetime of the access token.
+	ExpiresIn time.Duration
+}
+
+type IssueTokensParams struct {
+	UserID uuid.UUID
+	// Client is the authenticated client requesting the tokens.
+	Client *entity.Client
+	// Scopes must be allowed for the client, all of its scopes are granted
+	// when none are requested.
+	Scopes []string
+	// Audiences must be configured, the tokens have no audience when none
+	// are requested.
+	Audiences []string
+	ClientIP  net.IP
+	UserAgent string
+}
+
+func (s *AuthService) IssueTokens(ctx context.Context, p IssueTokensParams) (*IssuedTokens, error) {
+	userID, clientIP := p.UserID, p.ClientIP
+
+	scopes, err := grantScopes(p.Client.Scopes, p.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	audiences, err := s.grantAudiences(p.Audiences)
+	if err != nil {
+		return nil, err
+	}
+	accessTTL, refreshTTL := s.tokenTTLs(audiences)
+
+	roles := s.userRoles(ctx, userID)
+
+	accessID := uuid.New()
 	accessToken, err := s.generateToken(generateTokenParams{
-		userID:   userID,
-		clientIP: clientIP,
-		ttl:      s.accessTokenTTL,
-		jti:      uuid.New(),
-		secret:   s.accessTokenSecret,
+		userID:    userID,
+		clientID:  p.Client.ID,
+		clientIP:  clientIP,
+		scopes:    scopes,
+		roles:     roles,
+		audiences: audiences,
+		ttl:       accessTTL,
+		jti:       accessID,
+		keyring:   s.accessKeyring,
 	})
 	if err != nil {
-		return "", "", fmt.Errorf("generate access token: %w", err)
+		return nil, fmt.Errorf("generate access token: %w", err)
 	}
 
 	refreshID := uuid.New()
-	refreshToken, err := s.generateToken(generateTokenParams{
-		userID:   userID,
-		clientIP: clientIP,
-		ttl:      s.refreshTokenTTL,
-		jti:      refreshID,
-		secret:   s.refreshTokenSecret,
-	})
+	stored := &entity.RefreshToken{
+		UserID:    userID,
+		JTI:       refreshID,
+		FamilyID:  refreshID,
+		AccessJTI: accessID,
+		// The access token was signed a moment ago, so this is not before
+		// its exp.
+		AccessExpiresAt: time.Now().Add(accessTTL),
+		ClientID:        p.Client.ID,
+		Scopes:          scopes,
+		Audiences:       audiences,
+		ClientIP:        clientIP.String(),
+		UserAgent:       p.UserAgent,
+		ExpiresAt:       time.Now().Add(refreshTTL),
+	}
+	refreshToken, err := s.newRefreshToken(generateTokenParams{
+		userID:    userID,
+		clientID:  p.Client.ID,
+		clientIP:  clientIP,
+		scopes:    scopes,
+		ttl:       refreshTTL,
+		jti:       refreshID,
+		accessJTI: accessID,
+		keyring:   s.refreshKeyring,
+	}, stored)
 	if err != nil {
-		return "", "", fmt.Errorf("generate refresh token: %w", err)
+		return nil, fmt.Errorf("generate refresh token: %w", err)
+	}
+
+	if err := s.refreshTokenRepo.Save(ctx, stored); err != nil {
+		return nil, fmt.Errorf("save refresh token: %w", err)
 	}
 
-	hashed, err := s.hashToken(refreshToken)
+	return &IssuedTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		Scopes:       scopes,
+		ExpiresIn:    accessTTL,
+	}, nil
+}
+
+// userRoles returns the roles of the user. Users missing from the directory
+// have no roles, and neither do users it fails to look up, so that an outage
+// of the directory does not stop token issuance.
+func (s *AuthService) userRoles(ctx context.Context, userID uuid.UUID) []string {
+	if s.userDirectory == nil {
+		return nil
+	}
+
+	user, err := s.userDirectory.GetUser(ctx, userID)
 	if err != nil {
-		return "", "", fmt.Errorf("hash refresh token: %w", err)
+		if !errors.Is(err, repository.ErrUserNotFound) {
+			s.logger.WarnContext(
+				ctx,
+				"failed to look up user roles, issuing tokens without roles",
+				slog.String("user_id", userID.String()),
+				slog.Any("err", err),
+			)
+		}
+		return nil
+	}
+
+	return user.Roles
+}
+
+// RefreshTokenUserID returns the user a refresh token was issued to. Only the
+// signature and expiration of the token are checked, not whether it is revoked.
+// Opaque tokens carry no user, so they are looked up.
+func (s *AuthService) RefreshTokenUserID(ctx context.Context, refreshToken string) (uuid.UUID, error) {
+	if isOpaqueToken(refreshToken) {
+		_, stored, err := s.lookupOpaqueRefreshToken(ctx, refreshToken)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		return stored.UserID, nil
 	}
 
-	if err := s.refreshTokenRepo.Save(ctx, userID, refreshID, hashed); err != nil {
-		return "", "", fmt.Errorf("save refresh token: %w", err)
+	claims, err := s.parseToken(refreshToken, s.refreshKeyring)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("parse refresh token: %w", err)
 	}
 
-	return accessToken, refreshToken, nil
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return uuid.Nil, ErrInvalidToken
+	}
+	return userID, nil
 }
 
-func (s *AuthService) RefreshTokens(ctx context.Context, refreshToken string, clientIP net.IP) (string, string, error) {
-	claims, err := s.parseToken(refreshToken, s.refreshTokenSecret)
+func (s *AuthService) lookupRefreshToken(
+	ctx context.Context,
+	refreshToken string,
+) (*entity.TokenClaims, *entity.RefreshToken, error) {
+	if isOpaqueToken(refreshToken) {
+		return s.lookupOpaqueRefreshToken(ctx, refreshToken)
+	}
+
+	claims, err := s.parseToken(refreshToken, s.refreshKeyring)
 	if err != nil {
-		return "", "", fmt.Errorf("parse refresh token: %w", err)
+		return nil, nil, fmt.Errorf("parse refresh token: %w", err)
 	}
 
 	userID, err := uuid.Parse(claims.UserID)
 	if err != nil {
-		return "", "", ErrInvalidToken
+		return nil, nil, ErrInvalidToken
 	}
 	refreshID, err := uuid.Parse(claims.ID)
 	if err != nil {
-		return "", "", ErrInvalidToken
+		return nil, nil, ErrInvalidToken
 	}
 
-	storedHash, revoked, err := s.refreshTokenRepo.Get(ctx, userID, refreshID)
+	stored, err := s.refreshTokenRepo.Get(ctx, userID, refreshID)
 	if err != nil {
 		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
-			return "", "", ErrInvalidToken
+			return nil, nil, ErrInvalidToken
 		}
-		return "", "", fmt.Errorf("get refresh token: %w", err)
+		return nil, nil, fmt.Errorf("get refresh token: %w", err)
 	}
 
-	if revoked || !s.checkTokenHash(refreshToken, storedHash) || claims.ExpiresAt.Before(time.Now()) {
-		return "", "", ErrInvalidToken
+	if !s.checkTokenHash(refreshToken, stored.HashedToken) || claims.ExpiresAt.Before(time.Now()) {
+		return nil, nil, ErrInvalidToken
 	}
 
-	if clientIP.String() != claims.ClientIP {
-		err := s.emailNotifier.Send(
-			"example-user@gmail.com",
-			"Refresh Tokens Warning",
-			"We encounterd an issue while refreshing your tokens...",
-		)
+	return claims, stored, nil
+}
+
+func (s *AuthService) verifyRefreshToken(
+	ctx context.Context,
+	refreshToken string,
+) (*entity.TokenClaims, *entity.RefreshToken, error) {
+	claims, stored, err := s.lookupRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if stored.Revoked {
+		if !s.reuseDetection {
+			return nil, nil, ErrInvalidToken
+		}
+		if err := s.revokeTokenFamily(ctx, stored); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrTokenReused
+	}
+
+	return claims, stored, nil
+}
+
+type RefreshTokensParams struct {
+	// AccessToken is the access token issued alongside the refresh token. It
+	// is not needed when ClientID is set, the refresh_token grant of RFC 6749
+	// carries no access token and the client secret binds the refresh token
+	// to its owner instead.
+	AccessToken  string
+	RefreshToken string
+	// ClientID is the id of the authenticated client refreshing the tokens,
+	// the refresh token must have been issued to it.
+	ClientID string
+	// Scopes narrow the scopes of the new access token, they must have been
+	// granted to the refresh token. All of its scopes are kept when empty.
+	Scopes []string
+	// Audiences narrow the audiences of the new access token the same way.
+	Audiences []string
+	ClientIP  net.IP
+	UserAgent string
+}
+
+func (s *AuthService) RefreshTokens(ctx context.Context, p RefreshTokensParams) (*IssuedTokens, error) {
+	clientIP := p.ClientIP
+
+	claims, stored, err := s.verifyRefreshToken(ctx, p.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// An authenticated client proves the token is its own, so the pair check
+	// applies only to the /auth routes, where the caller holds nothing but
+	// the tokens.
+	if p.ClientID != "" {
+		if stored.ClientID != p.ClientID {
+			return nil, ErrClientMismatch
+		}
+	} else {
+		// The access token is usually expired by the time it is refreshed,
+		// so only its signature is checked here.
+		accessClaims, err := s.parseToken(p.AccessToken, s.accessKeyring, jwt.WithoutClaimsValidation())
 		if err != nil {
-			return "", "", fmt.Errorf("send warning email: %w", err)
+			return nil, fmt.Errorf("parse access token: %w", err)
+		}
+
+		if claims.AccessJTI == "" || claims.AccessJTI != accessClaims.ID || claims.UserID != accessClaims.UserID {
+			return nil, ErrTokenPairMismatch
 		}
 	}
 
+	userID, refreshID := stored.UserID, stored.JTI
+
+	// The new refresh token keeps the scopes of the family, so a narrowed
+	// refresh does not lose the others for good.
+	scopes, err := grantScopes(stored.Scopes, p.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Likewise for the audiences, whose lifetimes are looked up anew so
+	// that changed overrides apply on the next refresh.
+	audiences, err := narrow(stored.Audiences, p.Audiences, ErrInvalidAudience)
+	if err != nil {
+		return nil, err
+	}
+	accessTTL, _ := s.tokenTTLs(audiences)
+	_, refreshTTL := s.tokenTTLs(stored.Audiences)
+
+	roles := s.userRoles(ctx, userID)
+
+	var oldLoc, newLoc *entity.Location
+	if clientIP.String() != claims.ClientIP {
+		oldLoc, newLoc = s.locate(ctx, net.ParseIP(claims.ClientIP)), s.locate(ctx, clientIP)
+	}
+
+	decision := s.ipPolicy.decide(claims.ClientIP, clientIP, oldLoc, newLoc)
+	ipPolicyDecisions.Add(decision, 1)
+	if decision != ipDecisionUnchanged {
+		s.logger.InfoContext(
+			ctx,
+			"client ip changed on refresh",
+			slog.String("user_id", userID.String()),
+			slog.String("session_id", stored.FamilyID.String()),
+			slog.String("old_ip", claims.ClientIP),
+			slog.String("old_location", oldLoc.String()),
+			slog.String("new_ip", clientIP.String()),
+			slog.String("new_location", newLoc.String()),
+			slog.String("policy", s.ipPolicy.Mode),
+			slog.String("decision", decision),
+		)
+	}
+	if decision == ipDecisionDenied {
+		return nil, ErrClientIPChanged
+	}
+
+	newAccessID := uuid.New()
 	newAccessToken, err := s.generateToken(generateTokenParams{
-		userID:   userID,
-		clientIP: clientIP,
-		ttl:      s.accessTokenTTL,
-		jti:      uuid.New(),
-		secret:   s.accessTokenSecret,
+		userID:    userID,
+		clientID:  stored.ClientID,
+		clientIP:  clientIP,
+		scopes:    scopes,
+		roles:     roles,
+		audiences: audiences,
+		ttl:       accessTTL,
+		jti:       newAccessID,
+		keyring:   s.accessKeyring,
 	})
 	if err != nil {
-		return "", "", fmt.Errorf("generate new access token: %w", err)
+		return nil, fmt.Errorf("generate new access token: %w", err)
 	}
 
 	newRefreshID := uuid.New()
-	newRefreshToken, err := s.generateToken(generateTokenParams{
-		userID:   userID,
-		clientIP: clientIP,
-		ttl:      s.refreshTokenTTL,
-		jti:      newRefreshID,
-		secret:   s.refreshTokenSecret,
-	})
+	newStored := &entity.RefreshToken{
+		UserID:    userID,
+		JTI:       newRefreshID,
+		FamilyID:  stored.FamilyID,
+		ParentJTI: uuid.NullUUID{UUID: refreshID, Valid: true},
+		AccessJTI: newAccessID,
+		// Likewise not before the exp of the new access token.
+		AccessExpiresAt: time.Now().Add(accessTTL),
+		ClientID:        stored.ClientID,
+		Scopes:          stored.Scopes,
+		Audiences:       stored.Audiences,
+		ClientIP:        clientIP.String(),
+		UserAgent:       p.UserAgent,
+		ExpiresAt:       time.Now().Add(refreshTTL),
+		// Rotation keeps the session, so it keeps its start time.
+		SessionStartedAt: stored.SessionStartedAt,
+	}
+	newRefreshToken, err := s.newRefreshToken(generateTokenParams{
+		userID:    userID,
+		clientID:  stored.ClientID,
+		clientIP:  clientIP,
+		scopes:    stored.Scopes,
+		ttl:       refreshTTL,
+		jti:       newRefreshID,
+		accessJTI: newAccessID,
+		keyring:   s.refreshKeyring,
+	}, newStored)
 	if err != nil {
-		return "", "", fmt.Errorf("generate new refresh token: %w", err)
+		return nil, fmt.Errorf("generate new refresh token: %w", err)
 	}
 
-	newHashedRefreshToken, err := s.hashToken(newRefreshToken)
-	if err != nil {
-		return "", "", fmt.Errorf("hash new refresh token: %w", err)
+	var ipChangedEvent *entity.SecurityEvent
+	if decision == ipDecisionWarned {
+		revokeToken, err := s.generateRevokeToken(userID, stored.FamilyID)
+		if err != nil {
+			return nil, fmt.Errorf("generate revoke token: %w", err)
+		}
+		ipChangedEvent = &entity.SecurityEvent{
+			Type:        entity.SecurityEventIPChanged,
+			UserID:      userID,
+			OldIP:       claims.ClientIP,
+			OldLocation: oldLoc.String(),
+			NewIP:       clientIP.String(),
+			NewLocation: newLoc.String(),
+			UserAgent:   p.UserAgent,
+			OccurredAt:  time.Now(),
+			RevokeToken: revokeToken,
+		}
 	}
 
 	err = s.refreshTokenRepo.Transaction(ctx, func(ctx context.Context) error {
 		if err := s.refreshTokenRepo.Revoke(ctx, userID, refreshID); err != nil {
 			return fmt.Errorf("revoke old refresh token: %w", err)
 		}
-		if err := s.refreshTokenRepo.Save(ctx, userID, newRefreshID, newHashedRefreshToken); err != nil {
+		if ipChangedEvent != nil {
+			if err := s.outboxRepo.Enqueue(ctx, *ipChangedEvent); err != nil {
+				return fmt.Errorf("enqueue ip change warning: %w", err)
+			}
+		}
+		if err := s.refreshTokenRepo.Save(ctx, newStored); err != nil {
 			return fmt.Errorf("save new refresh token: %w", err)
 		}
 		return nil
 	})
 	if err != nil {
-		return "", "", fmt.Errorf("token refresh transaction: %w", err)
+		// The old token was revoked by a concurrent refresh after we read it.
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, fmt.Errorf("token refresh transaction: %w", err)
+	}
+
+	return &IssuedTokens{
+		AccessToken:  newAccessToken,
+		RefreshToken: newRefreshToken,
+		Scopes:       scopes,
+		ExpiresIn:    accessTTL,
+	}, nil
+}
+
+// locate returns the location of ip, or nil when it is unknown or GeoIP
+// lookups are disabled.
+func (s *AuthService) locate(ctx context.Context, ip net.IP) *entity.Location {
+	if s.geoIP == nil || ip == nil {
+		return nil
+	}
+
+	loc, err := s.geoIP.Locate(ip)
+	if err != nil {
+		if !errors.Is(err, repository.ErrLocationNotFound) {
+			s.logger.WarnContext(ctx, "failed to locate ip", slog.String("ip", ip.String()), slog.Any("err", err))
+		}
+		return nil
+	}
+	return loc
+}
+
+// revokeTokenFamily revokes the family of a reused token and warns the user.
+// Replays of a token whose family is revoked already revoke nothing, so they
+// do not warn again.
+func (s *AuthService) revokeTokenFamily(ctx context.Context, token *entity.RefreshToken) error {
+	var accessTokens []entity.AccessTokenRef
+
+	err := s.refreshTokenRepo.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		accessTokens, err = s.refreshTokenRepo.RevokeFamily(ctx, token.UserID, token.FamilyID)
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("revoke refresh token family: %w", err)
+		}
+
+		// The family is revoked already, the link in the warning signs out the rest.
+		revokeToken, err := s.generateRevokeToken(token.UserID, uuid.Nil)
+		if err != nil {
+			return fmt.Errorf("generate revoke token: %w", err)
+		}
+		if err := s.outboxRepo.Enqueue(ctx, entity.SecurityEvent{
+			Type:        entity.SecurityEventRefreshTokenReused,
+			UserID:      token.UserID,
+			OldIP:       token.ClientIP,
+			OldLocation: s.locate(ctx, net.ParseIP(token.ClientIP)).String(),
+			UserAgent:   token.UserAgent,
+			OccurredAt:  time.Now(),
+			RevokeToken: revokeToken,
+		}); err != nil {
+			return fmt.Errorf("enqueue reuse warning: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("token family revocation transaction: %w", err)
+	}
+
+	return s.denyAccessTokens(ctx, accessTokens...)
+}
+
+// Logout revokes the refresh token. Logging out with an already revoked
+// token succeeds without triggering reuse detection, it is usually a retry.
+func (s *AuthService) Logout(ctx context.Context, refreshToken string) error {
+	_, stored, err := s.lookupRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return err
+	}
+	if stored.Revoked {
+		return nil
+	}
+
+	if err := s.refreshTokenRepo.Revoke(ctx, stored.UserID, stored.JTI); err != nil {
+		// Revoked concurrently, e.g. by a refresh.
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			return nil
+		}
+		return fmt.Errorf("revoke refresh token: %w", err)
+	}
+
+	return s.denyAccessTokens(ctx, entity.AccessTokenRef{JTI: stored.AccessJTI, ExpiresAt: stored.AccessExpiresAt})
+}
+
+// LogoutAll revokes all refresh tokens of the user. Like Logout it succeeds
+// without doing anything when the token is already revoked.
+func (s *AuthService) LogoutAll(ctx context.Context, refreshToken string) error {
+	_, stored, err := s.lookupRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return err
+	}
+	if stored.Revoked {
+		return nil
+	}
+
+	accessTokens, err := s.refreshTokenRepo.RevokeAll(ctx, stored.UserID)
+	if err != nil {
+		return fmt.Errorf("revoke all refresh tokens: %w", err)
+	}
+
+	return s.denyAccessTokens(ctx, accessTokens...)
+}
+
+// denyAccessTokens puts access tokens on the denylist until they expire.
+// Tokens whose expiration was not recorded never outlive the longest access
+// TTL counted from now, so that moment is used for them.
+func (s *AuthService) denyAccessTokens(ctx context.Context, tokens ...entity.AccessTokenRef) error {
+	if s.accessDenylist == nil {
+		return nil
+	}
+
+	now := time.Now()
+	for _, t := range tokens {
+		if t.JTI == uuid.Nil {
+			continue
+		}
+
+		expiresAt := t.ExpiresAt
+		if expiresAt.IsZero() {
+			expiresAt = now.Add(s.maxAccessTokenTTL)
+		}
+		if !expiresAt.After(now) {
+			continue
+		}
+
+		if err := s.accessDenylist.Add(ctx, t.JTI, expiresAt); err != nil {
+			return fmt.Errorf("deny access token: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// VerifyAccessToken verifies an access token presented to the auth service
+// itself, which has to be issued for its audience when one is configured.
+func (s *AuthService) VerifyAccessToken(ctx context.Context, accessToken string) (*entity.TokenClaims, error) {
+	var opts []jwt.ParserOption
+	if s.audience != "" {
+		opts = append(opts, jwt.WithAudience(s.audience))
+	}
+	return s.verifyAccessToken(ctx, accessToken, opts...)
+}
+
+func (s *AuthService) verifyAccessToken(
+	ctx context.Context,
+	accessToken string,
+	opts ...jwt.ParserOption,
+) (*entity.TokenClaims, error) {
+	claims, err := s.parseToken(accessToken, s.accessKeyring, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("parse access token: %w", err)
+	}
+
+	if s.accessDenylist == nil {
+		return claims, nil
+	}
+
+	jti, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	denied, err := s.accessDenylist.Contains(ctx, jti)
+	if err != nil {
+		return nil, fmt.Errorf("check access token denylist: %w", err)
+	}
+	if denied {
+		return nil, ErrTokenRevoked
+	}
+
+	return claims, nil
+}
+
+// IntrospectToken reports whether a token is currently active. Invalid,
+// expired and revoked tokens are reported as inactive rather than as errors.
+// Unlike a refresh, presenting a revoked refresh token here does not trigger
+// reuse detection.
+func (s *AuthService) IntrospectToken(
+	ctx context.Context,
+	token, tokenTypeHint string,
+) (*entity.TokenIntrospection, error) {
+	introspectors := []func(context.Context, string) (*entity.TokenIntrospection, error){
+		s.introspectAccessToken,
+		s.introspectRefreshToken,
+	}
+	if tokenTypeHint == entity.TokenTypeRefresh {
+		introspectors[0], introspectors[1] = introspectors[1], introspectors[0]
+	}
+
+	for _, introspect := range introspectors {
+		result, err := introspect(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		if result.Active {
+			return result, nil
+		}
+	}
+
+	return &entity.TokenIntrospection{Active: false}, nil
+}
+
+// introspectAccessToken accepts tokens of any audience, the caller checks
+// the returned one.
+func (s *AuthService) introspectAccessToken(ctx context.Context, token string) (*entity.TokenIntrospection, error) {
+	claims, err := s.verifyAccessToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrTokenRevoked) {
+			return &entity.TokenIntrospection{Active: false}, nil
+		}
+		return nil, err
+	}
+
+	return &entity.TokenIntrospection{
+		Active:    true,
+		TokenType: entity.TokenTypeAccess,
+		Claims:    claims,
+	}, nil
+}
+
+func (s *AuthService) introspectRefreshToken(ctx context.Context, token string) (*entity.TokenIntrospection, error) {
+	claims, stored, err := s.lookupRefreshToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			return &entity.TokenIntrospection{Active: false}, nil
+		}
+		return nil, err
+	}
+
+	if stored.Revoked {
+		return &entity.TokenIntrospection{Active: false}, nil
+	}
+
+	return &entity.TokenIntrospection{
+		Active:    true,
+		TokenType: entity.TokenTypeRefresh,
+		Claims:    claims,
+	}, nil
+}
+
+// RevokeToken revokes a refresh or access token issued to the client as
+// RFC 7009 describes. Invalid, expired and already revoked tokens are ignored.
+func (s *AuthService) RevokeToken(ctx context.Context, token, tokenTypeHint, clientID string) error {
+	revokers := []func(context.Context, string, string) error{
+		s.revokeRefreshToken,
+		s.revokeAccessToken,
+	}
+	if tokenTypeHint == entity.TokenTypeAccess {
+		revokers[0], revokers[1] = revokers[1], revokers[0]
+	}
+
+	for _, revoke := range revokers {
+		if err := revoke(ctx, token, clientID); !errors.Is(err, ErrInvalidToken) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *AuthService) revokeRefreshToken(ctx context.Context, token, clientID string) error {
+	_, stored, err := s.lookupRefreshToken(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	if stored.ClientID != clientID {
+		return ErrClientMismatch
+	}
+	if stored.Revoked {
+		return nil
+	}
+
+	if err := s.refreshTokenRepo.Revoke(ctx, stored.UserID, stored.JTI); err != nil {
+		// Revoked concurrently, e.g. by a refresh.
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			return nil
+		}
+		return fmt.Errorf("revoke refresh token: %w", err)
+	}
+
+	return s.denyAccessTokens(ctx, entity.AccessTokenRef{JTI: stored.AccessJTI, ExpiresAt: stored.AccessExpiresAt})
+}
+
+func (s *AuthService) revokeAccessToken(ctx context.Context, token, clientID string) error {
+	claims, err := s.parseToken(token, s.accessKeyring)
+	if err != nil {
+		return fmt.Errorf("parse access token: %w", err)
+	}
+
+	if claims.AuthorizedParty != clientID {
+		return ErrClientMismatch
+	}
+	if s.accessDenylist == nil {
+		return ErrAccessTokenRevocationUnsupported
+	}
+
+	jti, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return ErrInvalidToken
 	}
 
-	return newAccessToken, newRefreshToken, nil
+	return s.denyAccessTokens(ctx, entity.AccessTokenRef{JTI: jti, ExpiresAt: claims.ExpiresAt.Time})
 }
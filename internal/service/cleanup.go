@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/vadimbarashkov/medods-test-task/internal/repository"
+)
+
+// CleanupService periodically deletes refresh tokens expired for longer than
+// the retention, revoked ones included, completed outbox messages, expired
+// used revoke tokens and access token denylist entries, and full rate limit
+// buckets, in small batches.
+type CleanupService struct {
+	interval            time.Duration
+	batchSize           int
+	retention           time.Duration
+	refreshTokenRepo    repository.RefreshTokenRepository
+	accessDenylist      repository.AccessTokenDenylist
+	usedRevokeTokenRepo repository.UsedRevokeTokenRepository
+	outboxRepo          repository.NotificationOutboxRepository
+	bucketRepo          repository.RateLimitBucketRepository
+	logger              *slog.Logger
+}
+
+type CleanupServiceParams struct {
+	Interval            time.Duration
+	BatchSize           int
+	Retention           time.Duration
+	RefreshTokenRepo    repository.RefreshTokenRepository
+	AccessDenylist      repository.AccessTokenDenylist
+	UsedRevokeTokenRepo repository.UsedRevokeTokenRepository
+	OutboxRepo          repository.NotificationOutboxRepository
+	BucketRepo          repository.RateLimitBucketRepository
+	Logger              *slog.Logger
+}
+
+func NewCleanupService(p CleanupServiceParams) *CleanupService {
+	return &CleanupService{
+		interval:            p.Interval,
+		batchSize:           p.BatchSize,
+		retention:           p.Retention,
+		refreshTokenRepo:    p.RefreshTokenRepo,
+		accessDenylist:      p.AccessDenylist,
+		usedRevokeTokenRepo: p.UsedRevokeTokenRepo,
+		outboxRepo:          p.OutboxRepo,
+		bucketRepo:          p.BucketRepo,
+		logger:              p.Logger,
+	}
+}
+
+// Run sweeps on every interval tick until ctx is cancelled.
+func (s *CleanupService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sweep(ctx)
+		}
+	}
+}
+
+func (s *CleanupService) sweep(ctx context.Context) {
+	deleted, err := s.deleteInBatches(ctx, func(ctx context.Context) (int64, error) {
+		return s.refreshTokenRepo.DeleteExpired(ctx, s.retention, s.batchSize)
+	})
+	if err != nil && ctx.Err() == nil {
+		s.logger.Error("failed to delete expired refresh tokens", slog.Any("err", err))
+	}
+	if deleted > 0 {
+		s.logger.Info("deleted expired refresh tokens", slog.Int64("count", deleted))
+	}
+
+	deleted, err = s.deleteInBatches(ctx, func(ctx context.Context) (int64, error) {
+		return s.outboxRepo.DeleteCompleted(ctx, s.retention, s.batchSize)
+	})
+	if err != nil && ctx.Err() == nil {
+		s.logger.Error("failed to delete completed outbox messages", slog.Any("err", err))
+	}
+	if deleted > 0 {
+		s.logger.Info("deleted completed outbox messages", slog.Int64("count", deleted))
+	}
+
+	deleted, err = s.deleteInBatches(ctx, func(ctx context.Context) (int64, error) {
+		return s.usedRevokeTokenRepo.DeleteExpired(ctx, s.batchSize)
+	})
+	if err != nil && ctx.Err() == nil {
+		s.logger.Error("failed to delete expired used revoke tokens", slog.Any("err", err))
+	}
+	if deleted > 0 {
+		s.logger.Info("deleted expired used revoke tokens", slog.Int64("count", deleted))
+	}
+
+	if s.accessDenylist != nil {
+		deleted, err = s.deleteInBatches(ctx, func(ctx context.Context) (int64, error) {
+			return s.accessDenylist.DeleteExpired(ctx, s.batchSize)
+		})
+		if err != nil && ctx.Err() == nil {
+			s.logger.Error("failed to delete expired access token denylist entries", slog.Any("err", err))
+		}
+		if deleted > 0 {
+			s.logger.Info("deleted expired access token denylist entries", slog.Int64("count", deleted))
+		}
+	}
+
+	if s.bucketRepo != nil {
+		deleted, err = s.deleteInBatches(ctx, func(ctx context.Context) (int64, error) {
+			return s.bucketRepo.DeleteExpired(ctx, s.batchSize)
+		})
+		if err != nil && ctx.Err() == nil {
+			s.logger.Error("failed to delete full rate limit buckets", slog.Any("err", err))
+		}
+		if deleted > 0 {
+			s.logger.Info("deleted full rate limit buckets", slog.Int64("count", deleted))
+		}
+	}
+}
+
+// deleteInBatches calls deleteBatch until it deletes less than a full batch,
+// so that every statement holds its locks only briefly.
+func (s *CleanupService) deleteInBatches(
+	ctx context.Context,
+	deleteBatch func(context.Context) (int64, error),
+) (int64, error) {
+	var total int64
+	for ctx.Err() == nil {
+		deleted, err := deleteBatch(ctx)
+		if err != nil {
+			return total, err
+		}
+		total += deleted
+		if deleted < int64(s.batchSize) {
+			break
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/vadimbarashkov/medods-test-task/internal/entity"
+	"github.com/vadimbarashkov/medods-test-task/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummySecretHash is compared against when the client does not exist, so that
+// unknown and known client ids take the same time to reject.
+var dummySecretHash, _ = bcrypt.GenerateFromPassword([]byte("dummy"), bcrypt.DefaultCost)
+
+// AuthenticateClient returns the client with the given id if secret matches
+// its hashed secret.
+func (s *AuthService) AuthenticateClient(ctx context.Context, clientID, secret string) (*entity.Client, error) {
+	client, err := s.clientRepo.Get(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrClientNotFound) {
+			_ = bcrypt.CompareHashAndPassword(dummySecretHash, []byte(secret))
+			return nil, ErrInvalidClient
+		}
+		return nil, fmt.Errorf("get client: %w", err)
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(client.HashedSecret), []byte(secret)) != nil {
+		return nil, ErrInvalidClient
+	}
+
+	return client, nil
+}
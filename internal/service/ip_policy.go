@@ -0,0 +1,115 @@
+package service
+
+import (
+	"expvar"
+	"net"
+
+	"github.com/vadimbarashkov/medods-test-task/internal/entity"
+)
+
+const (
+	// IPPolicyIgnore lets a refresh token be used from any IP.
+	IPPolicyIgnore = "ignore"
+	// IPPolicyWarn notifies the user when the IP changes.
+	IPPolicyWarn = "warn"
+	// IPPolicyDeny rejects a refresh from an IP other than the one the
+	// token was issued to, so the user has to sign in again.
+	IPPolicyDeny = "deny"
+	// IPPolicySubnet tolerates changes within the configured prefix, e.g. a
+	// mobile carrier rotating addresses, and notifies the user otherwise.
+	IPPolicySubnet = "subnet"
+)
+
+const (
+	GeoMatchNone          = "none"
+	GeoMatchASN           = "asn"
+	GeoMatchCountry       = "country"
+	GeoMatchASNAndCountry = "asn_and_country"
+)
+
+const (
+	ipDecisionUnchanged = "unchanged"
+	ipDecisionIgnored   = "ignored"
+	ipDecisionTolerated = "tolerated"
+	ipDecisionWarned    = "warned"
+	ipDecisionDenied    = "denied"
+)
+
+// ipPolicyDecisions counts decisions by their outcome, it is published at /debug/vars of the admin listener.
+var ipPolicyDecisions = expvar.NewMap("ip_policy_decisions")
+
+type IPPolicy struct {
+	// Mode is one of IPPolicyIgnore, IPPolicyWarn, IPPolicyDeny or IPPolicySubnet.
+	Mode string
+	// IPv4PrefixLen and IPv6PrefixLen are used by IPPolicySubnet.
+	IPv4PrefixLen int
+	IPv6PrefixLen int
+	// GeoMatch is one of GeoMatchNone, GeoMatchASN, GeoMatchCountry or
+	// GeoMatchASNAndCountry. Changes within the same network by that measure
+	// are tolerated whatever the mode.
+	GeoMatch string
+}
+
+// decide reports how a refresh from newIP of a token issued to oldIP is
+// handled. The locations are nil when unknown.
+func (p IPPolicy) decide(oldIP string, newIP net.IP, oldLoc, newLoc *entity.Location) string {
+	if oldIP == newIP.String() {
+		return ipDecisionUnchanged
+	}
+
+	if p.Mode == IPPolicyIgnore {
+		return ipDecisionIgnored
+	}
+	if p.sameNetwork(oldLoc, newLoc) {
+		return ipDecisionTolerated
+	}
+
+	switch p.Mode {
+	case IPPolicyDeny:
+		return ipDecisionDenied
+	case IPPolicySubnet:
+		if p.sameSubnet(net.ParseIP(oldIP), newIP) {
+			return ipDecisionTolerated
+		}
+		return ipDecisionWarned
+	default:
+		return ipDecisionWarned
+	}
+}
+
+func (p IPPolicy) sameNetwork(a, b *entity.Location) bool {
+	if a == nil || b == nil {
+		return false
+	}
+
+	sameASN := a.ASN != 0 && a.ASN == b.ASN
+	sameCountry := a.Country != "" && a.Country == b.Country
+
+	switch p.GeoMatch {
+	case GeoMatchASN:
+		return sameASN
+	case GeoMatchCountry:
+		return sameCountry
+	case GeoMatchASNAndCountry:
+		return sameASN && sameCountry
+	default:
+		return false
+	}
+}
+
+func (p IPPolicy) sameSubnet(a, b net.IP) bool {
+	if a == nil || b == nil {
+		return false
+	}
+
+	if a4, b4 := a.To4(), b.To4(); a4 != nil || b4 != nil {
+		if a4 == nil || b4 == nil {
+			return false
+		}
+		mask := net.CIDRMask(p.IPv4PrefixLen, 8*net.IPv4len)
+		return a4.Mask(mask).Equal(b4.Mask(mask))
+	}
+
+	mask := net.CIDRMask(p.IPv6PrefixLen, 8*net.IPv6len)
+	return a.Mask(mask).Equal(b.Mask(mask))
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"net"
+	"testing"
+
+	"github.com/vadimbarashkov/medods-test-task/internal/entity"
+)
+
+func TestIPPolicy_decide(t *testing.T) {
+	de := &entity.Location{Country: "DE", ASN: 3320}
+	deOtherASN := &entity.Location{Country: "DE", ASN: 6805}
+	fr := &entity.Location{Country: "FR", ASN: 3320}
+
+	tests := []struct {
+		name   string
+		policy IPPolicy
+		oldIP  string
+		newIP  string
+		oldLoc *entity.Location
+		newLoc *entity.Location
+		want   string
+	}{
+		{
+			name:   "same ip",
+			policy: IPPolicy{Mode: IPPolicyDeny},
+			oldIP:  "203.0.113.7",
+			newIP:  "203.0.113.7",
+			want:   ipDecisionUnchanged,
+		},
+		{
+			name:   "ignore",
+			policy: IPPolicy{Mode: IPPolicyIgnore},
+			oldIP:  "203.0.113.7",
+			newIP:  "198.51.100.1",
+			want:   ipDecisionIgnored,
+		},
+		{
+			name:   "warn",
+			policy: IPPolicy{Mode: IPPolicyWarn},
+			oldIP:  "203.0.113.7",
+			newIP:  "198.51.100.1",
+			want:   ipDecisionWarned,
+		},
+		{
+			name:   "deny",
+			policy: IPPolicy{Mode: IPPolicyDeny},
+			oldIP:  "203.0.113.7",
+			newIP:  "198.51.100.1",
+			want:   ipDecisionDenied,
+		},
+		{
+			name:   "subnet within prefix",
+			policy: IPPolicy{Mode: IPPolicySubnet, IPv4PrefixLen: 24},
+			oldIP:  "203.0.113.7",
+			newIP:  "203.0.113.200",
+			want:   ipDecisionTolerated,
+		},
+		{
+			name:   "subnet outside prefix",
+			policy: IPPolicy{Mode: IPPolicySubnet, IPv4PrefixLen: 24},
+			oldIP:  "203.0.113.7",
+			newIP:  "203.0.114.7",
+			want:   ipDecisionWarned,
+		},
+		{
+			name:   "same asn tolerated despite deny",
+			policy: IPPolicy{Mode: IPPolicyDeny, GeoMatch: GeoMatchASN},
+			oldIP:  "203.0.113.7",
+			newIP:  "198.51.100.1",
+			oldLoc: de,
+			newLoc: fr,
+			want:   ipDecisionTolerated,
+		},
+		{
+			name:   "same country tolerated",
+			policy: IPPolicy{Mode: IPPolicyWarn, GeoMatch: GeoMatchCountry},
+			oldIP:  "203.0.113.7",
+			newIP:  "198.51.100.1",
+			oldLoc: de,
+			newLoc: deOtherASN,
+			want:   ipDecisionTolerated,
+		},
+		{
+			name:   "asn and country requires both",
+			policy: IPPolicy{Mode: IPPolicyDeny, GeoMatch: GeoMatchASNAndCountry},
+			oldIP:  "203.0.113.7",
+			newIP:  "198.51.100.1",
+			oldLoc: de,
+			newLoc: fr,
+			want:   ipDecisionDenied,
+		},
+		{
+			name:   "unknown location is not the same network",
+			policy: IPPolicy{Mode: IPPolicyDeny, GeoMatch: GeoMatchCountry},
+			oldIP:  "203.0.113.7",
+			newIP:  "198.51.100.1",
+			oldLoc: de,
+			want:   ipDecisionDenied,
+		},
+		{
+			name:   "empty locations are not the same network",
+			policy: IPPolicy{Mode: IPPolicyDeny, GeoMatch: GeoMatchASNAndCountry},
+			oldIP:  "203.0.113.7",
+			newIP:  "198.51.100.1",
+			oldLoc: &entity.Location{},
+			newLoc: &entity.Location{},
+			want:   ipDecisionDenied,
+		},
+		{
+			name:   "geo match none",
+			policy: IPPolicy{Mode: IPPolicyDeny, GeoMatch: GeoMatchNone},
+			oldIP:  "203.0.113.7",
+			newIP:  "198.51.100.1",
+			oldLoc: de,
+			newLoc: de,
+			want:   ipDecisionDenied,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.policy.decide(tt.oldIP, net.ParseIP(tt.newIP), tt.oldLoc, tt.newLoc)
+			if got != tt.want {
+				t.Errorf("decide() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPPolicy_sameSubnet(t *testing.T) {
+	policy := IPPolicy{IPv4PrefixLen: 24, IPv6PrefixLen: 48}
+
+	tests := []struct {
+		name string
+		a, b string
+		want bool
+	}{
+		{name: "ipv4 same prefix", a: "203.0.113.7", b: "203.0.113.250", want: true},
+		{name: "ipv4 other prefix", a: "203.0.113.7", b: "203.0.112.7"},
+		{name: "ipv4-mapped ipv6 and ipv4", a: "::ffff:203.0.113.7", b: "203.0.113.8", want: true},
+		{name: "ipv6 same prefix", a: "2001:db8:cafe:1::1", b: "2001:db8:cafe:ffff::2", want: true},
+		{name: "ipv6 other prefix", a: "2001:db8:cafe::1", b: "2001:db8:beef::1"},
+		{name: "ipv4 and ipv6", a: "203.0.113.7", b: "2001:db8::1"},
+		{name: "invalid ip", a: "", b: "203.0.113.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.sameSubnet(net.ParseIP(tt.a), net.ParseIP(tt.b)); got != tt.want {
+				t.Errorf("sameSubnet(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/vadimbarashkov/medods-test-task/internal/entity"
+	"github.com/vadimbarashkov/medods-test-task/internal/repository"
+	"github.com/vadimbarashkov/medods-test-task/pkg/notifier"
+)
+
+var errNoRecipient = errors.New("user has no address for the notification channels")
+
+// NotificationDispatcher delivers security notifications written to the
+// outbox, retrying failed deliveries with exponential backoff and
+// dead-lettering messages that keep failing.
+type NotificationDispatcher struct {
+	pollInterval time.Duration
+	batchSize    int
+	lease        time.Duration
+	maxAttempts  int
+	baseBackoff  time.Duration
+	maxBackoff   time.Duration
+	outboxRepo   repository.NotificationOutboxRepository
+	// userDirectory is optional, without it notifications are skipped.
+	userDirectory repository.UserDirectory
+	notifier      *notifier.FanOut
+	revokeURL     string
+	logger        *slog.Logger
+}
+
+type NotificationDispatcherParams struct {
+	PollInterval  time.Duration
+	BatchSize     int
+	Lease         time.Duration
+	MaxAttempts   int
+	BaseBackoff   time.Duration
+	MaxBackoff    time.Duration
+	OutboxRepo    repository.NotificationOutboxRepository
+	UserDirectory repository.UserDirectory
+	Notifier      *notifier.FanOut
+	// RevokeURL is the "this wasn't me" link, its {token} placeholder is
+	// replaced with a session revoke token. The link is omitted when empty.
+	RevokeURL string
+	Logger    *slog.Logger
+}
+
+func NewNotificationDispatcher(p NotificationDispatcherParams) *NotificationDispatcher {
+	return &NotificationDispatcher{
+		pollInterval:  p.PollInterval,
+		batchSize:     p.BatchSize,
+		lease:         p.Lease,
+		maxAttempts:   p.MaxAttempts,
+		baseBackoff:   p.BaseBackoff,
+		maxBackoff:    p.MaxBackoff,
+		outboxRepo:    p.OutboxRepo,
+		userDirectory: p.UserDirectory,
+		notifier:      p.Notifier,
+		revokeURL:     p.RevokeURL,
+		logger:        p.Logger,
+	}
+}
+
+// Run polls the outbox on every interval tick until ctx is cancelled.
+func (d *NotificationDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.dispatch(ctx)
+		}
+	}
+}
+
+func (d *NotificationDispatcher) dispatch(ctx context.Context) {
+	for ctx.Err() == nil {
+		messages, err := d.outboxRepo.Claim(ctx, d.batchSize, d.lease)
+		if err != nil {
+			if ctx.Err() == nil {
+				d.logger.Error("failed to claim outbox messages", slog.Any("err", err))
+			}
+			return
+		}
+
+		for _, msg := range messages {
+			d.process(ctx, msg)
+		}
+
+		if len(messages) < d.batchSize {
+			return
+		}
+	}
+}
+
+func (d *NotificationDispatcher) process(ctx context.Context, msg entity.OutboxMessage) {
+	logger := d.logger.With(
+		slog.String("message_id", msg.ID.String()),
+		slog.String("event", msg.Event.Type),
+		slog.String("user_id", msg.Event.UserID.String()),
+		slog.Int("attempt", msg.Attempts),
+	)
+
+	delivered, err := d.deliver(ctx, msg)
+	switch {
+	case err == nil:
+		err = d.outboxRepo.MarkDelivered(ctx, msg.ID)
+	case errors.Is(err, errNoRecipient):
+		logger.Warn("skipping security notification, user has no address for the notification channels")
+		err = d.outboxRepo.MarkSkipped(ctx, msg.ID, err.Error())
+	case msg.Attempts >= d.maxAttempts:
+		logger.Error("giving up on security notification", slog.Any("err", err))
+		err = d.outboxRepo.MarkDead(ctx, msg.ID, err.Error())
+	default:
+		backoff := d.backoff(msg.Attempts)
+		logger.Warn(
+			"failed to deliver security notification, retrying",
+			slog.Any("err", err),
+			slog.Duration("backoff", backoff),
+			slog.Any("delivered_channels", delivered),
+		)
+		err = d.outboxRepo.Reschedule(ctx, msg.ID, time.Now().Add(backoff), delivered, err.Error())
+	}
+
+	if err != nil && ctx.Err() == nil {
+		logger.Error("failed to update outbox message", slog.Any("err", err))
+	}
+}
+
+// backoff doubles the delay after every attempt, starting from baseBackoff
+// and capped at maxBackoff.
+func (d *NotificationDispatcher) backoff(attempts int) time.Duration {
+	backoff := d.baseBackoff
+	for i := 1; i < attempts && backoff < d.maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, d.maxBackoff)
+}
+
+// deliver notifies the user over the channels the message has not been
+// delivered to yet and returns all channels it has been delivered to.
+func (d *NotificationDispatcher) deliver(ctx context.Context, msg entity.OutboxMessage) ([]string, error) {
+	if d.userDirectory == nil {
+		return nil, errNoRecipient
+	}
+
+	event := msg.Event
+	user, err := d.userDirectory.GetUser(ctx, event.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, errNoRecipient
+		}
+		return msg.DeliveredChannels, fmt.Errorf("get user: %w", err)
+	}
+
+	delivered, err := d.notifier.NotifyChannels(ctx, notifier.Recipient{
+		Email:          user.Email,
+		Phone:          user.Phone,
+		TelegramChatID: user.TelegramChatID,
+		Locale:         user.Locale,
+	}, notifier.Event{
+		ID:          msg.ID.String(),
+		Type:        event.Type,
+		UserID:      event.UserID.String(),
+		OldIP:       event.OldIP,
+		OldLocation: event.OldLocation,
+		NewIP:       event.NewIP,
+		NewLocation: event.NewLocation,
+		UserAgent:   event.UserAgent,
+		OccurredAt:  event.OccurredAt,
+		RevokeURL:   d.revokeLink(event.RevokeToken),
+	}, msg.DeliveredChannels)
+	if err != nil {
+		if errors.Is(err, notifier.ErrNoRecipient) {
+			return nil, errNoRecipient
+		}
+		return delivered, fmt.Errorf("notify user: %w", err)
+	}
+
+	return delivered, nil
+}
+
+const revokeTokenPlaceholder = "{token}"
+
+func (d *NotificationDispatcher) revokeLink(revokeToken string) string {
+	if d.revokeURL == "" || revokeToken == "" {
+		return ""
+	}
+	return strings.ReplaceAll(d.revokeURL, revokeTokenPlaceholder, url.QueryEscape(revokeToken))
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/vadimbarashkov/medods-test-task/internal/repository"
+)
+
+type RateLimit struct {
+	// Requests are allowed per Per on average, zero disables the limit.
+	Requests int
+	Per      time.Duration
+	// Burst is the number of requests allowed at once.
+	Burst int
+}
+
+func (l RateLimit) Enabled() bool {
+	return l.Requests > 0
+}
+
+type RateLimitResult struct {
+	Allowed bool
+	// Limit is the bucket size, Remaining is what is left of it.
+	Limit     int
+	Remaining int
+	// RetryAfter is set when the request is not allowed.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+// RateLimiter implements token bucket rate limiting.
+type RateLimiter struct {
+	bucketRepo repository.RateLimitBucketRepository
+}
+
+func NewRateLimiter(bucketRepo repository.RateLimitBucketRepository) *RateLimiter {
+	return &RateLimiter{bucketRepo: bucketRepo}
+}
+
+func (l *RateLimiter) Allow(ctx context.Context, key string, limit RateLimit) (*RateLimitResult, error) {
+	rate := float64(limit.Requests) / limit.Per.Seconds()
+
+	allowed, tokens, err := l.bucketRepo.Take(ctx, key, rate, limit.Burst)
+	if err != nil {
+		return nil, fmt.Errorf("take token: %w", err)
+	}
+
+	result := &RateLimitResult{
+		Allowed:   allowed,
+		Limit:     limit.Burst,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     secondsToDuration((float64(limit.Burst) - tokens) / rate),
+	}
+	if !allowed {
+		result.RetryAfter = secondsToDuration((1 - tokens) / rate)
+	}
+
+	return result, nil
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(max(s, 0) * float64(time.Second))
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/vadimbarashkov/medods-test-task/internal/entity"
+	"github.com/vadimbarashkov/medods-test-task/internal/repository"
+)
+
+const (
+	// RefreshTokenFormatJWT issues refresh tokens as signed JWTs.
+	RefreshTokenFormatJWT = "jwt"
+	// RefreshTokenFormatOpaque issues refresh tokens as random values that
+	// carry no data.
+	RefreshTokenFormatOpaque = "opaque"
+)
+
+// An opaque refresh token is 256 random bits, base64url encoded. The first
+// half is the selector the row is looked up by, the second half is the
+// verifier, of which only the hash is stored.
+const (
+	opaqueTokenSize    = 32
+	opaqueSelectorSize = 16
+)
+
+// newRefreshToken generates a refresh token in the configured format and sets
+// the hash, and for opaque tokens the selector, of its row.
+func (s *AuthService) newRefreshToken(p generateTokenParams, row *entity.RefreshToken) (string, error) {
+	if s.refreshTokenFormat == RefreshTokenFormatOpaque {
+		b := make([]byte, opaqueTokenSize)
+		if _, err := rand.Read(b); err != nil {
+			return "", fmt.Errorf("generate opaque token: %w", err)
+		}
+		row.Selector = base64.RawURLEncoding.EncodeToString(b[:opaqueSelectorSize])
+		row.HashedToken = hashVerifier(b[opaqueSelectorSize:])
+		return base64.RawURLEncoding.EncodeToString(b), nil
+	}
+
+	token, err := s.generateToken(p)
+	if err != nil {
+		return "", err
+	}
+
+	hashed, err := s.hashToken(token)
+	if err != nil {
+		return "", fmt.Errorf("hash token: %w", err)
+	}
+	row.HashedToken = hashed
+
+	return token, nil
+}
+
+// The verifier is 128 random bits and cannot be brute forced, so unlike JWT
+// refresh tokens it is not hashed with bcrypt, which keeps lookups cheap.
+func hashVerifier(verifier []byte) string {
+	sum := sha256.Sum256(verifier)
+	return hex.EncodeToString(sum[:])
+}
+
+// isOpaqueToken tells opaque refresh tokens apart from JWTs, so that tokens
+// issued before the format was switched keep working.
+func isOpaqueToken(token string) bool {
+	return !strings.Contains(token, ".")
+}
+
+func (s *AuthService) lookupOpaqueRefreshToken(
+	ctx context.Context,
+	refreshToken string,
+) (*entity.TokenClaims, *entity.RefreshToken, error) {
+	b, err := base64.RawURLEncoding.DecodeString(refreshToken)
+	if err != nil || len(b) != opaqueTokenSize {
+		return nil, nil, ErrInvalidToken
+	}
+
+	selector := base64.RawURLEncoding.EncodeToString(b[:opaqueSelectorSize])
+	stored, err := s.refreshTokenRepo.GetBySelector(ctx, selector)
+	if err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			return nil, nil, ErrInvalidToken
+		}
+		return nil, nil, fmt.Errorf("get refresh token: %w", err)
+	}
+
+	hashed := hashVerifier(b[opaqueSelectorSize:])
+	if subtle.ConstantTimeCompare([]byte(hashed), []byte(stored.HashedToken)) != 1 || stored.ExpiresAt.Before(time.Now()) {
+		return nil, nil, ErrInvalidToken
+	}
+
+	return refreshTokenClaims(s.issuer, stored), stored, nil
+}
+
+// refreshTokenClaims returns the claims a JWT refresh token of the row would
+// carry.
+func refreshTokenClaims(issuer string, token *entity.RefreshToken) *entity.TokenClaims {
+	claims := &entity.TokenClaims{
+		UserID:          token.UserID.String(),
+		ClientIP:        token.ClientIP,
+		AuthorizedParty: token.ClientID,
+		Scope:           FormatScope(token.Scopes),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   token.UserID.String(),
+			ExpiresAt: jwt.NewNumericDate(token.ExpiresAt),
+			ID:        token.JTI.String(),
+		},
+	}
+
+	if !token.CreatedAt.IsZero() {
+		claims.IssuedAt = jwt.NewNumericDate(token.CreatedAt)
+	}
+	if token.AccessJTI != uuid.Nil {
+		claims.AccessJTI = token.AccessJTI.String()
+	}
+	return claims
+}
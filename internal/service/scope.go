@@ -0,0 +1,40 @@
+package service
+
+import (
+	"slices"
+	"strings"
+)
+
+// ParseScope splits a space separated scope parameter.
+func ParseScope(scope string) []string {
+	return strings.Fields(scope)
+}
+
+func FormatScope(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// grantScopes returns the requested scopes if every one of them is allowed,
+// or all allowed scopes when none are requested.
+func grantScopes(allowed, requested []string) ([]string, error) {
+	return narrow(allowed, requested, ErrInvalidScope)
+}
+
+// narrow returns the requested values without duplicates if every one of them
+// is allowed, or all allowed values when none are requested.
+func narrow(allowed, requested []string, errNotAllowed error) ([]string, error) {
+	if len(requested) == 0 {
+		return slices.Clone(allowed), nil
+	}
+
+	granted := make([]string, 0, len(requested))
+	for _, v := range requested {
+		if !slices.Contains(allowed, v) {
+			return nil, errNotAllowed
+		}
+		if !slices.Contains(granted, v) {
+			granted = append(granted, v)
+		}
+	}
+	return granted, nil
+}
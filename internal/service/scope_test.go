@@ -0,0 +1,78 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestNarrow(t *testing.T) {
+	errNotAllowed := errors.New("not allowed")
+
+	tests := []struct {
+		name      string
+		allowed   []string
+		requested []string
+		want      []string
+		wantErr   error
+	}{
+		{
+			name:    "nothing requested grants everything allowed",
+			allowed: []string{"read", "write"},
+			want:    []string{"read", "write"},
+		},
+		{
+			name:      "subset",
+			allowed:   []string{"read", "write"},
+			requested: []string{"write"},
+			want:      []string{"write"},
+		},
+		{
+			name:      "duplicates removed in request order",
+			allowed:   []string{"read", "write"},
+			requested: []string{"write", "read", "write"},
+			want:      []string{"write", "read"},
+		},
+		{
+			name:      "not allowed",
+			allowed:   []string{"read"},
+			requested: []string{"read", "admin"},
+			wantErr:   errNotAllowed,
+		},
+		{
+			name:      "nothing allowed",
+			requested: []string{"read"},
+			wantErr:   errNotAllowed,
+		},
+		{
+			name: "nothing allowed or requested",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := narrow(tt.allowed, tt.requested, errNotAllowed)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("narrow() error = %v, want %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("narrow() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNarrow_DoesNotAliasAllowed(t *testing.T) {
+	allowed := []string{"read", "write"}
+
+	got, err := narrow(allowed, nil, ErrInvalidScope)
+	if err != nil {
+		t.Fatalf("narrow() error = %v", err)
+	}
+	got[0] = "admin"
+
+	if allowed[0] != "read" {
+		t.Errorf("narrow() result aliases allowed, allowed = %q", allowed)
+	}
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/vadimbarashkov/medods-test-task/internal/entity"
+	"github.com/vadimbarashkov/medods-test-task/internal/repository"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+func (s *AuthService) ListSessions(ctx context.Context, userID uuid.UUID) ([]entity.Session, error) {
+	sessions, err := s.refreshTokenRepo.ListSessions(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+
+	for i := range sessions {
+		sessions[i].Location = s.locate(ctx, net.ParseIP(sessions[i].ClientIP))
+	}
+
+	return sessions, nil
+}
+
+func (s *AuthService) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	accessTokens, err := s.refreshTokenRepo.RevokeFamily(ctx, userID, sessionID)
+	if err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			return ErrSessionNotFound
+		}
+		return fmt.Errorf("revoke session: %w", err)
+	}
+
+	return s.denyAccessTokens(ctx, accessTokens...)
+}
+
+// revokeTokenAudience tells session revoke tokens apart from refresh tokens,
+// which are signed with the same keys.
+const revokeTokenAudience = "session_revoke"
+
+// generateRevokeToken issues a token that signs out the sessionID session of
+// the user, or all of their sessions when sessionID is uuid.Nil. It is sent in
+// security notifications so the user can react without being signed in.
+func (s *AuthService) generateRevokeToken(userID, sessionID uuid.UUID) (string, error) {
+	claims := &entity.TokenClaims{
+		UserID: userID.String(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer,
+			Subject:   userID.String(),
+			Audience:  jwt.ClaimStrings{revokeTokenAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.revokeTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        uuid.NewString(),
+		},
+	}
+
+	if sessionID != uuid.Nil {
+		claims.SessionID = sessionID.String()
+	}
+
+	key := s.refreshKeyring.Active()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.SignKey())
+}
+
+// RevokeSessionsByToken signs out the sessions a revoke token was issued for.
+// A revoke token works once, so a leaked link cannot sign the user out of
+// sessions started after it was used. Revoking an already revoked session is
+// not an error.
+func (s *AuthService) RevokeSessionsByToken(ctx context.Context, revokeToken string) error {
+	claims, err := s.parseToken(revokeToken, s.refreshKeyring, jwt.WithAudience(revokeTokenAudience))
+	if err != nil {
+		return fmt.Errorf("parse revoke token: %w", err)
+	}
+
+	jti, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	var sessionID uuid.UUID
+	if claims.SessionID != "" {
+		if sessionID, err = uuid.Parse(claims.SessionID); err != nil {
+			return ErrInvalidToken
+		}
+	}
+
+	var accessTokens []entity.AccessTokenRef
+
+	// The token is used only if the sessions are revoked.
+	err = s.refreshTokenRepo.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.usedRevokeTokenRepo.Use(ctx, jti, claims.ExpiresAt.Time); err != nil {
+			if errors.Is(err, repository.ErrRevokeTokenUsed) {
+				return fmt.Errorf("%w: %w", ErrInvalidToken, err)
+			}
+			return fmt.Errorf("use revoke token: %w", err)
+		}
+
+		var err error
+		if sessionID == uuid.Nil {
+			accessTokens, err = s.refreshTokenRepo.RevokeAll(ctx, userID)
+		} else {
+			accessTokens, err = s.refreshTokenRepo.RevokeFamily(ctx, userID, sessionID)
+			if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+				err = nil
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("revoke refresh tokens: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("revoke token transaction: %w", err)
+	}
+
+	return s.denyAccessTokens(ctx, accessTokens...)
+}
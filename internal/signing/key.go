@@ -0,0 +1,129 @@
+package signing
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vadimbarashkov/medods-test-task/pkg/jwk"
+)
+
+const (
+	AlgHS512 = "HS512"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+var ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// RetireAt is the moment the key stops being accepted for verification.
+	// Zero value means the key never retires.
+	RetireAt  time.Time
+	signKey   any
+	verifyKey any
+}
+
+func NewHMACKey(id string, secret []byte) *Key {
+	return &Key{
+		ID:        id,
+		Method:    jwt.SigningMethodHS512,
+		signKey:   secret,
+		verifyKey: secret,
+	}
+}
+
+func (k *Key) Retired(now time.Time) bool {
+	return !k.RetireAt.IsZero() && !now.Before(k.RetireAt)
+}
+
+// LoadKey reads a PEM encoded private key for an asymmetric algorithm.
+// If id is empty, the RFC 7638 thumbprint of the public key is used.
+func LoadKey(id, algorithm, path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key file: %w", err)
+	}
+
+	key := &Key{ID: id}
+
+	switch algorithm {
+	case AlgRS256:
+		priv, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse RSA private key: %w", err)
+		}
+		key.Method = jwt.SigningMethodRS256
+		key.signKey = priv
+		key.verifyKey = &priv.PublicKey
+	case AlgES256:
+		priv, err := jwt.ParseECPrivateKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse EC private key: %w", err)
+		}
+		if priv.Curve.Params().BitSize != 256 {
+			return nil, fmt.Errorf("ES256 requires a P-256 key, got %s", priv.Curve.Params().Name)
+		}
+		key.Method = jwt.SigningMethodES256
+		key.signKey = priv
+		key.verifyKey = &priv.PublicKey
+	case AlgEdDSA:
+		priv, err := jwt.ParseEdPrivateKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse Ed25519 private key: %w", err)
+		}
+		signer, ok := priv.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("parse Ed25519 private key: not a signer")
+		}
+		key.Method = jwt.SigningMethodEdDSA
+		key.signKey = priv
+		key.verifyKey = signer.Public()
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, algorithm)
+	}
+
+	if key.ID == "" {
+		jwkKey, err := jwk.FromPublicKey(key.verifyKey)
+		if err != nil {
+			return nil, fmt.Errorf("convert public key: %w", err)
+		}
+		if key.ID, err = jwkKey.Thumbprint(); err != nil {
+			return nil, fmt.Errorf("compute key thumbprint: %w", err)
+		}
+	}
+
+	return key, nil
+}
+
+func (k *Key) SignKey() any {
+	return k.signKey
+}
+
+func (k *Key) VerifyKey() any {
+	return k.verifyKey
+}
+
+// JWK returns the public part of the key, or false for symmetric keys
+// that must never be published.
+func (k *Key) JWK() (jwk.Key, bool) {
+	if _, ok := k.Method.(*jwt.SigningMethodHMAC); ok {
+		return jwk.Key{}, false
+	}
+
+	key, err := jwk.FromPublicKey(k.verifyKey)
+	if err != nil {
+		return jwk.Key{}, false
+	}
+
+	key.Kid = k.ID
+	key.Use = jwk.UseSignature
+	key.Alg = k.Method.Alg()
+	return key, true
+}
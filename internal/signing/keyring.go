@@ -0,0 +1,83 @@
+package signing
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrKeyNotFound = errors.New("signing key not found")
+	// ErrActiveKeyRetires is returned for an active key with a retire time,
+	// it would keep signing tokens past it.
+	ErrActiveKeyRetires = errors.New("active signing key has a retire time")
+)
+
+// Keyring holds the key used to sign new tokens and the keys still accepted
+// for verification. It is safe for concurrent use and must be filled with
+// Replace before use.
+type Keyring struct {
+	mu     sync.RWMutex
+	active *Key
+	keys   map[string]*Key
+}
+
+func (r *Keyring) Replace(activeID string, keys ...*Key) error {
+	byID := make(map[string]*Key, len(keys))
+	for _, k := range keys {
+		if _, ok := byID[k.ID]; ok {
+			return fmt.Errorf("duplicate signing key %q", k.ID)
+		}
+		byID[k.ID] = k
+	}
+
+	active, ok := byID[activeID]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrKeyNotFound, activeID)
+	}
+	if !active.RetireAt.IsZero() {
+		return fmt.Errorf("%w: %q", ErrActiveKeyRetires, activeID)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.active = active
+	r.keys = byID
+	return nil
+}
+
+func (r *Keyring) Active() *Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.active
+}
+
+// Lookup returns the key with the given id if it has not been retired yet.
+func (r *Keyring) Lookup(id string) (*Key, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	k, ok := r.keys[id]
+	if !ok || k.Retired(time.Now()) {
+		return nil, false
+	}
+	return k, true
+}
+
+// Keys returns every key that is not retired yet.
+func (r *Keyring) Keys() []*Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	keys := make([]*Key, 0, len(r.keys))
+	for _, k := range r.keys {
+		if !k.Retired(now) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,3 @@
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS access_jti;
+
+DROP TABLE IF EXISTS access_token_denylist;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS access_token_denylist(
+    jti UUID PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS access_token_denylist_expires_at_idx ON access_token_denylist(expires_at);
+
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS access_jti UUID;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS refresh_tokens_user_id_active_idx;
+
+ALTER TABLE refresh_tokens
+    DROP COLUMN IF EXISTS session_started_at,
+    DROP COLUMN IF EXISTS user_agent,
+    DROP COLUMN IF EXISTS client_ip;
@@ -0,0 +1,12 @@
+ALTER TABLE refresh_tokens
+    ADD COLUMN IF NOT EXISTS client_ip TEXT,
+    ADD COLUMN IF NOT EXISTS user_agent TEXT,
+    ADD COLUMN IF NOT EXISTS session_started_at TIMESTAMP;
+
+UPDATE refresh_tokens SET session_started_at = created_at WHERE session_started_at IS NULL;
+
+ALTER TABLE refresh_tokens
+    ALTER COLUMN session_started_at SET DEFAULT CURRENT_TIMESTAMP,
+    ALTER COLUMN session_started_at SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_user_id_active_idx ON refresh_tokens(user_id) WHERE revoked = FALSE;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS refresh_tokens_expires_at_idx;
+
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS expires_at;
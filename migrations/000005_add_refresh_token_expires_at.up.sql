@@ -0,0 +1,6 @@
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+
+-- Rows issued before this migration are left NULL, the configured
+-- refresh_ttl is not known here. The service sets them from it on startup.
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_expires_at_idx ON refresh_tokens(expires_at);
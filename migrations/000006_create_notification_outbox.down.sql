@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS notification_outbox_update_updated_at ON notification_outbox;
+
+DROP TABLE IF EXISTS notification_outbox;
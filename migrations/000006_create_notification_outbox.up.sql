@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS notification_outbox(
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error TEXT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT notification_outbox_status_check CHECK (status IN ('pending', 'delivered', 'skipped', 'dead'))
+);
+
+CREATE INDEX IF NOT EXISTS notification_outbox_pending_idx
+    ON notification_outbox(next_attempt_at)
+    WHERE status = 'pending';
+
+CREATE OR REPLACE TRIGGER notification_outbox_update_updated_at
+    BEFORE UPDATE ON notification_outbox
+    FOR EACH ROW
+    EXECUTE FUNCTION update_timestamp();
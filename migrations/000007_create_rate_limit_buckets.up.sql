@@ -0,0 +1,9 @@
+-- Buckets are cheap to lose, so the table skips the WAL.
+CREATE UNLOGGED TABLE IF NOT EXISTS rate_limit_buckets(
+    key TEXT PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    full_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS rate_limit_buckets_full_at_idx ON rate_limit_buckets(full_at);
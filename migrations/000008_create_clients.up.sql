@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS clients(
+    id TEXT PRIMARY KEY,
+    -- bcrypt hash of the client secret
+    hashed_secret TEXT NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Tokens issued before clients were introduced have no client.
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS client_id TEXT;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS refresh_tokens_selector_idx;
+
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS selector;
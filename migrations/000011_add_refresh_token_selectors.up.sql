@@ -0,0 +1,3 @@
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS selector TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS refresh_tokens_selector_idx ON refresh_tokens(selector);
@@ -0,0 +1 @@
+ALTER TABLE notification_outbox ADD COLUMN IF NOT EXISTS delivered_channels TEXT[] NOT NULL DEFAULT '{}';
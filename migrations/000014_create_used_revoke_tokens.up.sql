@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS used_revoke_tokens(
+    jti UUID PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS used_revoke_tokens_expires_at_idx ON used_revoke_tokens(expires_at);
@@ -0,0 +1,4 @@
+ALTER TABLE refresh_tokens
+    ALTER COLUMN session_started_at TYPE TIMESTAMP,
+    ALTER COLUMN created_at TYPE TIMESTAMP,
+    ALTER COLUMN updated_at TYPE TIMESTAMP;
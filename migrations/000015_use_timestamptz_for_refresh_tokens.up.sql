@@ -0,0 +1,4 @@
+ALTER TABLE refresh_tokens
+    ALTER COLUMN session_started_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN updated_at TYPE TIMESTAMPTZ;
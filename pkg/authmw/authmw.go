@@ -0,0 +1,218 @@
+// Package authmw verifies access tokens issued by the auth service in
+// downstream HTTP services.
+package authmw
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vadimbarashkov/medods-test-task/pkg/clientip"
+)
+
+// Claims is the payload of access tokens issued by the auth service.
+type Claims struct {
+	UserID   string `json:"user_id"`
+	ClientIP string `json:"client_ip"`
+	// AuthorizedParty is the id of the client the token was issued to.
+	AuthorizedParty string `json:"azp,omitempty"`
+	// Scope is the space separated list of granted scopes.
+	Scope string   `json:"scope,omitempty"`
+	Roles []string `json:"roles,omitempty"`
+	jwt.RegisteredClaims
+}
+
+var (
+	ErrMissingToken    = errors.New("missing bearer token")
+	ErrClientIPChanged = errors.New("client ip does not match token")
+)
+
+// HasScope reports whether scope was granted to the token.
+func HasScope(claims *Claims, scope string) bool {
+	return slices.Contains(strings.Fields(claims.Scope), scope)
+}
+
+// HasRole reports whether the user of the token has role.
+func HasRole(claims *Claims, role string) bool {
+	return slices.Contains(claims.Roles, role)
+}
+
+type claimsKey struct{}
+
+func ContextWithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
+
+type options struct {
+	parserOpts   []jwt.ParserOption
+	clientIP     func(*http.Request) net.IP
+	errorHandler func(http.ResponseWriter, *http.Request, error)
+}
+
+type Option func(*options)
+
+// WithAudience requires the token to be issued for the given audience.
+func WithAudience(aud string) Option {
+	return func(o *options) {
+		o.parserOpts = append(o.parserOpts, jwt.WithAudience(aud))
+	}
+}
+
+// WithIssuer requires the token to be issued by the given issuer.
+func WithIssuer(iss string) Option {
+	return func(o *options) {
+		o.parserOpts = append(o.parserOpts, jwt.WithIssuer(iss))
+	}
+}
+
+// WithLeeway tolerates clock skew when checking exp, nbf and iat.
+func WithLeeway(d time.Duration) Option {
+	return func(o *options) {
+		o.parserOpts = append(o.parserOpts, jwt.WithLeeway(d))
+	}
+}
+
+// WithValidMethods restricts the accepted signing algorithms.
+func WithValidMethods(methods ...string) Option {
+	return func(o *options) {
+		o.parserOpts = append(o.parserOpts, jwt.WithValidMethods(methods))
+	}
+}
+
+// WithIPBinding rejects tokens presented from an IP other than the one they
+// were issued to. If clientIP is nil, RequestIP is used.
+func WithIPBinding(clientIP func(*http.Request) net.IP) Option {
+	return func(o *options) {
+		if clientIP == nil {
+			clientIP = RequestIP
+		}
+		o.clientIP = clientIP
+	}
+}
+
+// WithErrorHandler overrides the default 401 JSON response.
+func WithErrorHandler(fn func(http.ResponseWriter, *http.Request, error)) Option {
+	return func(o *options) {
+		o.errorHandler = fn
+	}
+}
+
+// RequestIP returns the IP resolved by the clientip middleware, or the host
+// of r.RemoteAddr when the middleware is not installed.
+func RequestIP(r *http.Request) net.IP {
+	if ip, ok := clientip.FromContext(r.Context()); ok {
+		return ip
+	}
+	return RemoteAddrIP(r)
+}
+
+func RemoteAddrIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// New returns a chi compatible middleware that verifies the bearer access
+// token with keyfunc and stores its claims in the request context.
+func New(keyfunc Keyfunc, opts ...Option) func(http.Handler) http.Handler {
+	o := &options{errorHandler: defaultErrorHandler}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	parser := jwt.NewParser(o.parserOpts...)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				o.errorHandler(w, r, ErrMissingToken)
+				return
+			}
+
+			claims := &Claims{}
+			_, err := parser.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+				return keyfunc(r.Context(), t)
+			})
+			if err != nil {
+				o.errorHandler(w, r, err)
+				return
+			}
+
+			if o.clientIP != nil && !net.ParseIP(claims.ClientIP).Equal(o.clientIP(r)) {
+				o.errorHandler(w, r, ErrClientIPChanged)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(ContextWithClaims(r.Context(), claims)))
+		})
+	}
+}
+
+// RequireScope responds with 403 unless every scope was granted to the token.
+// It must be installed after New.
+func RequireScope(scopes ...string) func(http.Handler) http.Handler {
+	return require(func(claims *Claims) bool {
+		for _, scope := range scopes {
+			if !HasScope(claims, scope) {
+				return false
+			}
+		}
+		return true
+	}, fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, strings.Join(scopes, " ")))
+}
+
+// RequireRole responds with 403 unless the user has one of the roles.
+// It must be installed after New.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return require(func(claims *Claims) bool {
+		return slices.ContainsFunc(roles, func(role string) bool {
+			return HasRole(claims, role)
+		})
+	}, `Bearer error="insufficient_scope"`)
+}
+
+func require(allowed func(*Claims) bool, challenge string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok || !allowed(claims) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("WWW-Authenticate", challenge)
+				w.WriteHeader(http.StatusForbidden)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": "insufficient permissions"})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+func defaultErrorHandler(w http.ResponseWriter, _ *http.Request, _ error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	w.WriteHeader(http.StatusUnauthorized)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid or missing access token"})
+}
@@ -0,0 +1,243 @@
+package authmw
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func signTestToken(t *testing.T, claims *Claims) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString(testSecret)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return token
+}
+
+func testClaims(mutate func(c *Claims)) *Claims {
+	c := &Claims{
+		UserID:   "9f1d6c1e-8a8e-4e53-9a55-6f8f0c7d2b10",
+		ClientIP: "203.0.113.7",
+		Scope:    "invoices:read invoices:write",
+		Roles:    []string{"accountant"},
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "https://auth.example.com",
+			Audience:  jwt.ClaimStrings{"billing"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	if mutate != nil {
+		mutate(c)
+	}
+	return c
+}
+
+// serve runs r through mw and returns the response status and the claims the
+// next handler saw.
+func serve(mw func(http.Handler) http.Handler, r *http.Request) (int, *Claims) {
+	var claims *Claims
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ = ClaimsFromContext(r.Context())
+	})
+
+	w := httptest.NewRecorder()
+	mw(next).ServeHTTP(w, r)
+	return w.Code, claims
+}
+
+func TestNew(t *testing.T) {
+	keyfunc := StaticKeyfunc(jwt.SigningMethodHS512, testSecret)
+
+	tests := []struct {
+		name       string
+		authHeader string
+		remoteAddr string
+		opts       []Option
+		wantStatus int
+	}{
+		{
+			name:       "valid token",
+			authHeader: "Bearer " + signTestToken(t, testClaims(nil)),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "lowercase scheme",
+			authHeader: "bearer " + signTestToken(t, testClaims(nil)),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "missing token",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "other scheme",
+			authHeader: "Basic dXNlcjpwYXNz",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "malformed token",
+			authHeader: "Bearer not-a-jwt",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "expired token",
+			authHeader: "Bearer " + signTestToken(t, testClaims(func(c *Claims) {
+				c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+			})),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "expired token within leeway",
+			authHeader: "Bearer " + signTestToken(t, testClaims(func(c *Claims) {
+				c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-10 * time.Second))
+			})),
+			opts:       []Option{WithLeeway(time.Minute)},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "wrong signature",
+			authHeader: "Bearer " + signTestToken(t, testClaims(nil)) + "x",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "audience",
+			authHeader: "Bearer " + signTestToken(t, testClaims(nil)),
+			opts:       []Option{WithAudience("billing")},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "other audience",
+			authHeader: "Bearer " + signTestToken(t, testClaims(nil)),
+			opts:       []Option{WithAudience("reports")},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "other issuer",
+			authHeader: "Bearer " + signTestToken(t, testClaims(nil)),
+			opts:       []Option{WithIssuer("https://evil.example.com")},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "method not allowed",
+			authHeader: "Bearer " + signTestToken(t, testClaims(nil)),
+			opts:       []Option{WithValidMethods("ES256")},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "ip binding",
+			authHeader: "Bearer " + signTestToken(t, testClaims(nil)),
+			remoteAddr: "203.0.113.7:1234",
+			opts:       []Option{WithIPBinding(nil)},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "ip binding from another ip",
+			authHeader: "Bearer " + signTestToken(t, testClaims(nil)),
+			remoteAddr: "198.51.100.1:1234",
+			opts:       []Option{WithIPBinding(nil)},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authHeader != "" {
+				r.Header.Set("Authorization", tt.authHeader)
+			}
+			if tt.remoteAddr != "" {
+				r.RemoteAddr = tt.remoteAddr
+			}
+
+			status, claims := serve(New(keyfunc, tt.opts...), r)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if status == http.StatusOK && (claims == nil || claims.UserID != testClaims(nil).UserID) {
+				t.Errorf("claims = %+v, want the token claims", claims)
+			}
+		})
+	}
+}
+
+func TestNew_KeyfuncGetsRequestContext(t *testing.T) {
+	type ctxKey struct{}
+
+	var got any
+	keyfunc := func(ctx context.Context, _ *jwt.Token) (any, error) {
+		got = ctx.Value(ctxKey{})
+		return testSecret, nil
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(context.WithValue(r.Context(), ctxKey{}, "request"))
+	r.Header.Set("Authorization", "Bearer "+signTestToken(t, testClaims(nil)))
+
+	if status, _ := serve(New(keyfunc), r); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	if got != "request" {
+		t.Errorf("keyfunc ctx value = %v, want the request context", got)
+	}
+}
+
+func TestRequire(t *testing.T) {
+	tests := []struct {
+		name       string
+		mw         func(http.Handler) http.Handler
+		claims     *Claims
+		wantStatus int
+	}{
+		{
+			name:       "granted scopes",
+			mw:         RequireScope("invoices:read", "invoices:write"),
+			claims:     testClaims(nil),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "missing scope",
+			mw:         RequireScope("invoices:read", "invoices:delete"),
+			claims:     testClaims(nil),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "one of the roles",
+			mw:         RequireRole("admin", "accountant"),
+			claims:     testClaims(nil),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "none of the roles",
+			mw:         RequireRole("admin"),
+			claims:     testClaims(nil),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "no claims",
+			mw:         RequireScope("invoices:read"),
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.claims != nil {
+				r = r.WithContext(ContextWithClaims(r.Context(), tt.claims))
+			}
+
+			if status, _ := serve(tt.mw, r); status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package authmw
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vadimbarashkov/medods-test-task/pkg/jwk"
+	"golang.org/x/sync/singleflight"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// Keyfunc returns the key a token is verified with. ctx is the context of the
+// request the token came with.
+type Keyfunc func(ctx context.Context, t *jwt.Token) (any, error)
+
+// StaticKeyfunc verifies tokens with a single key, e.g. a shared HS512 secret
+// or a public key loaded from PEM. The token algorithm must match method.
+func StaticKeyfunc(method jwt.SigningMethod, key any) Keyfunc {
+	return func(_ context.Context, t *jwt.Token) (any, error) {
+		if t.Method.Alg() != method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+		}
+		return key, nil
+	}
+}
+
+// JWKS fetches and caches the key set published by the auth service at
+// /.well-known/jwks.json. The set is refetched when it is older than ttl or
+// when a token references an unknown kid, at most once per minRefresh.
+// Concurrent lookups share a single fetch, and the cached set keeps serving
+// other lookups while it runs.
+type JWKS struct {
+	url        string
+	client     *http.Client
+	ttl        time.Duration
+	minRefresh time.Duration
+	// fetchTimeout bounds a fetch, which outlives the lookup starting it.
+	fetchTimeout time.Duration
+	refresh      singleflight.Group
+
+	mu        sync.Mutex
+	set       jwk.Set
+	fetchedAt time.Time
+}
+
+func NewJWKS(url string, client *http.Client, ttl time.Duration) *JWKS {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &JWKS{
+		url:          url,
+		client:       client,
+		ttl:          ttl,
+		minRefresh:   30 * time.Second,
+		fetchTimeout: 10 * time.Second,
+	}
+}
+
+func (j *JWKS) Keyfunc(ctx context.Context, t *jwt.Token) (any, error) {
+	kid, ok := t.Header["kid"].(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: token has no kid", ErrUnknownKey)
+	}
+
+	key, err := j.lookup(ctx, kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if key.Alg != "" && key.Alg != t.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+	}
+
+	return key.PublicKey()
+}
+
+func (j *JWKS) lookup(ctx context.Context, kid string) (jwk.Key, error) {
+	j.mu.Lock()
+	since := time.Since(j.fetchedAt)
+	key, found := j.set.Lookup(kid)
+	j.mu.Unlock()
+
+	if since >= j.ttl || (!found && since >= j.minRefresh) {
+		set, err := j.refetch(ctx)
+		if err != nil {
+			if found {
+				return key, nil
+			}
+			return jwk.Key{}, err
+		}
+		key, found = set.Lookup(kid)
+	}
+
+	if !found {
+		return jwk.Key{}, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+	return key, nil
+}
+
+// refetch fetches the key set and caches it. Lookups that need it while a
+// fetch is running wait for that fetch, or until their ctx is done.
+func (j *JWKS) refetch(ctx context.Context) (jwk.Set, error) {
+	ch := j.refresh.DoChan("", func() (any, error) {
+		// The fetch is shared, so it is not canceled with the lookup that
+		// happened to start it.
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), j.fetchTimeout)
+		defer cancel()
+
+		set, err := j.fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		j.mu.Lock()
+		j.set, j.fetchedAt = set, time.Now()
+		j.mu.Unlock()
+
+		return set, nil
+	})
+
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return jwk.Set{}, res.Err
+		}
+		return res.Val.(jwk.Set), nil
+	case <-ctx.Done():
+		return jwk.Set{}, ctx.Err()
+	}
+}
+
+func (j *JWKS) fetch(ctx context.Context) (jwk.Set, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return jwk.Set{}, fmt.Errorf("create request: %w", err)
+	}
+
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return jwk.Set{}, fmt.Errorf("fetch key set: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return jwk.Set{}, fmt.Errorf("fetch key set: unexpected status %d", resp.StatusCode)
+	}
+
+	var set jwk.Set
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return jwk.Set{}, fmt.Errorf("decode key set: %w", err)
+	}
+	return set, nil
+}
@@ -0,0 +1,238 @@
+package authmw
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vadimbarashkov/medods-test-task/pkg/jwk"
+)
+
+// testJWKSServer serves the key set it holds and counts the fetches.
+type testJWKSServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	set     jwk.Set
+	status  int
+	fetches atomic.Int32
+	// block, when set, holds every response until it is closed.
+	block chan struct{}
+	// started receives a value when a request arrives.
+	started chan struct{}
+}
+
+func newTestJWKSServer(t *testing.T, keys ...jwk.Key) *testJWKSServer {
+	t.Helper()
+
+	s := &testJWKSServer{
+		set:     jwk.Set{Keys: keys},
+		status:  http.StatusOK,
+		started: make(chan struct{}, 16),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.started <- struct{}{}
+
+		s.mu.Lock()
+		set, status, block := s.set, s.status, s.block
+		s.mu.Unlock()
+
+		if block != nil {
+			<-block
+		}
+
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *testJWKSServer) setKeys(status int, keys ...jwk.Key) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set, s.status = jwk.Set{Keys: keys}, status
+}
+
+// testKey returns a P-256 key and its JWK.
+func testKey(t *testing.T, kid string) (*ecdsa.PrivateKey, jwk.Key) {
+	t.Helper()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	key, err := jwk.FromPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatalf("FromPublicKey() error = %v", err)
+	}
+	key.Kid, key.Alg, key.Use = kid, jwt.SigningMethodES256.Alg(), jwk.UseSignature
+
+	return priv, key
+}
+
+func testToken(method jwt.SigningMethod, kid string) *jwt.Token {
+	t := jwt.New(method)
+	if kid != "" {
+		t.Header["kid"] = kid
+	}
+	return t
+}
+
+func TestJWKS_Keyfunc(t *testing.T) {
+	priv, key := testKey(t, "key-1")
+	s := newTestJWKSServer(t, key)
+	j := NewJWKS(s.URL, nil, time.Hour)
+
+	tests := []struct {
+		name    string
+		token   *jwt.Token
+		wantErr bool
+		// errIs is the error wanted, if any in particular.
+		errIs error
+	}{
+		{
+			name:  "known kid",
+			token: testToken(jwt.SigningMethodES256, "key-1"),
+		},
+		{
+			name:    "unknown kid",
+			token:   testToken(jwt.SigningMethodES256, "key-2"),
+			wantErr: true,
+			errIs:   ErrUnknownKey,
+		},
+		{
+			name:    "no kid",
+			token:   testToken(jwt.SigningMethodES256, ""),
+			wantErr: true,
+			errIs:   ErrUnknownKey,
+		},
+		{
+			name:    "algorithm of another key",
+			token:   testToken(jwt.SigningMethodRS256, "key-1"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := j.Keyfunc(context.Background(), tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Keyfunc() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.errIs != nil && !errors.Is(err, tt.errIs) {
+				t.Fatalf("Keyfunc() error = %v, want %v", err, tt.errIs)
+			}
+			if err == nil && !priv.PublicKey.Equal(got) {
+				t.Errorf("Keyfunc() = %v, want the public key of %q", got, "key-1")
+			}
+		})
+	}
+
+	if got := s.fetches.Load(); got != 1 {
+		t.Errorf("fetches = %d, want 1 within minRefresh", got)
+	}
+}
+
+func TestJWKS_RefetchOnUnknownKid(t *testing.T) {
+	_, key1 := testKey(t, "key-1")
+	priv2, key2 := testKey(t, "key-2")
+	s := newTestJWKSServer(t, key1)
+
+	j := NewJWKS(s.URL, nil, time.Hour)
+	j.minRefresh = 0
+
+	if _, err := j.Keyfunc(context.Background(), testToken(jwt.SigningMethodES256, "key-1")); err != nil {
+		t.Fatalf("Keyfunc() error = %v", err)
+	}
+
+	// The auth service rotated its keys after the set was cached.
+	s.setKeys(http.StatusOK, key1, key2)
+
+	got, err := j.Keyfunc(context.Background(), testToken(jwt.SigningMethodES256, "key-2"))
+	if err != nil {
+		t.Fatalf("Keyfunc() error = %v", err)
+	}
+	if !priv2.PublicKey.Equal(got) {
+		t.Errorf("Keyfunc() = %v, want the public key of %q", got, "key-2")
+	}
+	if got := s.fetches.Load(); got != 2 {
+		t.Errorf("fetches = %d, want 2", got)
+	}
+}
+
+func TestJWKS_KeepsCachedSetWhenRefetchFails(t *testing.T) {
+	_, key := testKey(t, "key-1")
+	s := newTestJWKSServer(t, key)
+
+	// Every lookup refetches the set.
+	j := NewJWKS(s.URL, nil, 0)
+
+	if _, err := j.Keyfunc(context.Background(), testToken(jwt.SigningMethodES256, "key-1")); err != nil {
+		t.Fatalf("Keyfunc() error = %v", err)
+	}
+
+	s.setKeys(http.StatusInternalServerError)
+
+	if _, err := j.Keyfunc(context.Background(), testToken(jwt.SigningMethodES256, "key-1")); err != nil {
+		t.Errorf("Keyfunc() error = %v, want the cached key", err)
+	}
+	if _, err := j.Keyfunc(context.Background(), testToken(jwt.SigningMethodES256, "key-2")); err == nil {
+		t.Error("Keyfunc() error = nil, want the fetch error")
+	}
+}
+
+func TestJWKS_SharedFetchOutlivesCanceledLookup(t *testing.T) {
+	priv, key := testKey(t, "key-1")
+	s := newTestJWKSServer(t, key)
+	s.block = make(chan struct{})
+
+	j := NewJWKS(s.URL, nil, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := j.Keyfunc(ctx, testToken(jwt.SigningMethodES256, "key-1"))
+		first <- err
+	}()
+
+	<-s.started
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Keyfunc() error = %v, want context.Canceled", err)
+	}
+
+	// The fetch started by the canceled lookup is still running and is
+	// shared with this one.
+	second := make(chan error, 1)
+	var got any
+	go func() {
+		var err error
+		got, err = j.Keyfunc(context.Background(), testToken(jwt.SigningMethodES256, "key-1"))
+		second <- err
+	}()
+
+	close(s.block)
+	if err := <-second; err != nil {
+		t.Fatalf("Keyfunc() error = %v", err)
+	}
+	if !priv.PublicKey.Equal(got) {
+		t.Errorf("Keyfunc() = %v, want the public key of %q", got, "key-1")
+	}
+	if got := s.fetches.Load(); got != 1 {
+		t.Errorf("fetches = %d, want 1", got)
+	}
+}
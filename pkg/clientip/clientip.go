@@ -0,0 +1,169 @@
+// Package clientip resolves the IP of the client behind trusted reverse
+// proxies from the X-Forwarded-For and RFC 7239 Forwarded headers.
+package clientip
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type ctxKey struct{}
+
+func NewContext(ctx context.Context, ip net.IP) context.Context {
+	return context.WithValue(ctx, ctxKey{}, ip)
+}
+
+// FromContext returns the IP stored by the Resolver middleware.
+func FromContext(ctx context.Context) (net.IP, bool) {
+	ip, ok := ctx.Value(ctxKey{}).(net.IP)
+	return ip, ok
+}
+
+// Resolver trusts forwarding headers only when the request comes from one of
+// the trusted proxies. With no trusted proxies the headers are ignored and the
+// IP of the peer is used.
+type Resolver struct {
+	trusted []netip.Prefix
+}
+
+func NewResolver(trustedProxies []netip.Prefix) *Resolver {
+	return &Resolver{trusted: trustedProxies}
+}
+
+// ParsePrefixes parses CIDRs and single addresses, which are treated as /32
+// or /128 prefixes.
+func ParsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Middleware stores the resolved client IP in the request context.
+func (res *Resolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), res.Resolve(r))))
+	})
+}
+
+// Resolve walks the forwarding chain from the peer towards the client and
+// returns the first hop that is not a trusted proxy. The Forwarded header
+// takes precedence over X-Forwarded-For. If a hop cannot be parsed, e.g. it
+// is "unknown" or obfuscated, the last trusted hop is returned, and if every
+// hop is trusted the leftmost one is.
+func (res *Resolver) Resolve(r *http.Request) net.IP {
+	peer, ok := parseNode(r.RemoteAddr)
+	if !ok {
+		return nil
+	}
+	if !res.isTrusted(peer) {
+		return net.IP(peer.AsSlice())
+	}
+
+	var hops []string
+	if values := r.Header.Values("Forwarded"); len(values) > 0 {
+		hops = forwardedFor(values)
+	} else {
+		for _, v := range r.Header.Values("X-Forwarded-For") {
+			hops = append(hops, strings.Split(v, ",")...)
+		}
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseNode(hops[i])
+		if !ok {
+			break
+		}
+		client = addr
+		if !res.isTrusted(addr) {
+			break
+		}
+	}
+
+	return net.IP(client.AsSlice())
+}
+
+func (res *Resolver) isTrusted(addr netip.Addr) bool {
+	for _, p := range res.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor returns the for= parameters of the Forwarded header elements,
+// in order.
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, v := range values {
+		for _, element := range splitQuoted(v, ',') {
+			for _, pair := range splitQuoted(element, ';') {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					hops = append(hops, strings.Trim(value, `"`))
+				}
+			}
+		}
+	}
+	return hops
+}
+
+// splitQuoted splits s on sep outside of double-quoted strings.
+func splitQuoted(s string, sep byte) []string {
+	var (
+		parts  []string
+		quoted bool
+		start  int
+	)
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case '\\':
+			if quoted {
+				i++
+			}
+		case sep:
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseNode parses an IP optionally followed by a port, IPv6 addresses may
+// be in brackets.
+func parseNode(node string) (netip.Addr, bool) {
+	node = strings.TrimSpace(node)
+
+	if addrPort, err := netip.ParseAddrPort(node); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+
+	node = strings.TrimSuffix(strings.TrimPrefix(node, "["), "]")
+	addr, err := netip.ParseAddr(node)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
@@ -0,0 +1,304 @@
+package clientip
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestResolver_Resolve(t *testing.T) {
+	trusted, err := ParsePrefixes([]string{"10.0.0.0/8", "2001:db8:ffff::1"})
+	if err != nil {
+		t.Fatalf("ParsePrefixes() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		trusted    []netip.Prefix
+		remoteAddr string
+		xff        []string
+		forwarded  []string
+		want       string
+	}{
+		{
+			name:       "no trusted proxies ignores headers",
+			remoteAddr: "10.0.0.1:1234",
+			xff:        []string{"203.0.113.7"},
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "untrusted peer ignores headers",
+			trusted:    trusted,
+			remoteAddr: "198.51.100.1:1234",
+			xff:        []string{"203.0.113.7"},
+			forwarded:  []string{"for=203.0.113.8"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "trusted peer without headers",
+			trusted:    trusted,
+			remoteAddr: "10.0.0.1:1234",
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "trusted peer",
+			trusted:    trusted,
+			remoteAddr: "10.0.0.1:1234",
+			xff:        []string{"203.0.113.7"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "spoofed left-hand entries are skipped",
+			trusted:    trusted,
+			remoteAddr: "10.0.0.1:1234",
+			xff:        []string{"1.2.3.4, 10.0.0.9, 203.0.113.7"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "chain of trusted proxies",
+			trusted:    trusted,
+			remoteAddr: "10.0.0.1:1234",
+			xff:        []string{"203.0.113.7, 10.0.0.3,10.0.0.2"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "every hop trusted returns the leftmost",
+			trusted:    trusted,
+			remoteAddr: "10.0.0.1:1234",
+			xff:        []string{"10.0.0.3, 10.0.0.2"},
+			want:       "10.0.0.3",
+		},
+		{
+			name:       "multiple X-Forwarded-For lines",
+			trusted:    trusted,
+			remoteAddr: "10.0.0.1:1234",
+			xff:        []string{"1.2.3.4", "203.0.113.7, 10.0.0.2"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "unparsable X-Forwarded-For hop returns the last trusted hop",
+			trusted:    trusted,
+			remoteAddr: "10.0.0.1:1234",
+			xff:        []string{"203.0.113.7, not-an-ip, 10.0.0.2"},
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "Forwarded takes precedence",
+			trusted:    trusted,
+			remoteAddr: "10.0.0.1:1234",
+			xff:        []string{"1.2.3.4"},
+			forwarded:  []string{"for=203.0.113.7"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "Forwarded quoted IPv4 with port",
+			trusted:    trusted,
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{`for="203.0.113.7:8080";proto=https`},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "Forwarded quoted bracketed IPv6 with port",
+			trusted:    trusted,
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{`for="[2001:db8:cafe::17]:4711"`},
+			want:       "2001:db8:cafe::17",
+		},
+		{
+			name:       "Forwarded quoted bracketed IPv6 without port",
+			trusted:    trusted,
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{`For="[2001:db8:cafe::17]"`},
+			want:       "2001:db8:cafe::17",
+		},
+		{
+			name:       "Forwarded unknown hop returns the last trusted hop",
+			trusted:    trusted,
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{"for=203.0.113.7, for=unknown, for=10.0.0.2"},
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "Forwarded obfuscated hop returns the peer",
+			trusted:    trusted,
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{`for=203.0.113.7, for="_gazonk"`},
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "multiple Forwarded lines",
+			trusted:    trusted,
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{"for=1.2.3.4", `for=203.0.113.7;by="10.0.0.2, x", for=10.0.0.2`},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "trusted IPv6 peer",
+			trusted:    trusted,
+			remoteAddr: "[2001:db8:ffff::1]:1234",
+			xff:        []string{"2001:db8:cafe::17"},
+			want:       "2001:db8:cafe::17",
+		},
+		{
+			name:       "IPv4-mapped peer is unmapped",
+			trusted:    trusted,
+			remoteAddr: "[::ffff:10.0.0.1]:1234",
+			xff:        []string{"203.0.113.7"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "invalid peer",
+			trusted:    trusted,
+			remoteAddr: "@",
+			xff:        []string{"203.0.113.7"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			for _, v := range tt.forwarded {
+				r.Header.Add("Forwarded", v)
+			}
+
+			got := NewResolver(tt.trusted).Resolve(r)
+			if tt.want == "" {
+				if got != nil {
+					t.Errorf("Resolve() = %v, want nil", got)
+				}
+				return
+			}
+			if got.String() != tt.want {
+				t.Errorf("Resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForwardedFor(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []string
+	}{
+		{
+			name:   "single element",
+			values: []string{"for=192.0.2.60;proto=http;by=203.0.113.43"},
+			want:   []string{"192.0.2.60"},
+		},
+		{
+			name:   "elements and lines in order",
+			values: []string{"for=192.0.2.43, for=198.51.100.17", "for=10.0.0.2"},
+			want:   []string{"192.0.2.43", "198.51.100.17", "10.0.0.2"},
+		},
+		{
+			name:   "quoted values keep separators",
+			values: []string{`for="[2001:db8:cafe::17]:4711";by="a;b,c"`},
+			want:   []string{"[2001:db8:cafe::17]:4711"},
+		},
+		{
+			name:   "case insensitive key and spaces",
+			values: []string{"proto=https; FOR=192.0.2.60"},
+			want:   []string{"192.0.2.60"},
+		},
+		{
+			name:   "unknown and obfuscated",
+			values: []string{`for=unknown, for="_hidden"`},
+			want:   []string{"unknown", "_hidden"},
+		},
+		{
+			name:   "elements without for",
+			values: []string{"by=203.0.113.43;proto=https, host=example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := forwardedFor(tt.values); !slices.Equal(got, tt.want) {
+				t.Errorf("forwardedFor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitQuoted(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		sep  byte
+		want []string
+	}{
+		{name: "no separator", s: "for=a", sep: ',', want: []string{"for=a"}},
+		{name: "separators", s: "a,b,,c", sep: ',', want: []string{"a", "b", "", "c"}},
+		{name: "quoted separator", s: `a="x,y",b`, sep: ',', want: []string{`a="x,y"`, "b"}},
+		{name: "escaped quote", s: `a="x\",y",b`, sep: ',', want: []string{`a="x\",y"`, "b"}},
+		{name: "other separator", s: `for=a;by="b;c"`, sep: ';', want: []string{"for=a", `by="b;c"`}},
+		{name: "empty", s: "", sep: ',', want: []string{""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitQuoted(tt.s, tt.sep); !slices.Equal(got, tt.want) {
+				t.Errorf("splitQuoted() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNode(t *testing.T) {
+	tests := []struct {
+		node   string
+		want   string
+		wantOK bool
+	}{
+		{node: "203.0.113.7", want: "203.0.113.7", wantOK: true},
+		{node: " 203.0.113.7 ", want: "203.0.113.7", wantOK: true},
+		{node: "203.0.113.7:8080", want: "203.0.113.7", wantOK: true},
+		{node: "2001:db8::1", want: "2001:db8::1", wantOK: true},
+		{node: "[2001:db8::1]", want: "2001:db8::1", wantOK: true},
+		{node: "[2001:db8::1]:4711", want: "2001:db8::1", wantOK: true},
+		{node: "::ffff:203.0.113.7", want: "203.0.113.7", wantOK: true},
+		{node: "unknown"},
+		{node: "_hidden"},
+		{node: "203.0.113.7:_port"},
+		{node: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.node, func(t *testing.T) {
+			got, ok := parseNode(tt.node)
+			if ok != tt.wantOK {
+				t.Fatalf("parseNode(%q) ok = %v, want %v", tt.node, ok, tt.wantOK)
+			}
+			if ok && got.String() != tt.want {
+				t.Errorf("parseNode(%q) = %v, want %v", tt.node, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePrefixes(t *testing.T) {
+	got, err := ParsePrefixes([]string{"10.1.2.3/8", "192.0.2.1", "::ffff:192.0.2.2", "2001:db8::/32"})
+	if err != nil {
+		t.Fatalf("ParsePrefixes() error = %v", err)
+	}
+
+	want := []string{"10.0.0.0/8", "192.0.2.1/32", "192.0.2.2/32", "2001:db8::/32"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d prefixes, want %d", len(got), len(want))
+	}
+	for i, p := range got {
+		if p.String() != want[i] {
+			t.Errorf("prefix %d = %v, want %v", i, p, want[i])
+		}
+	}
+
+	if _, err := ParsePrefixes([]string{"not-a-cidr"}); err == nil {
+		t.Error("ParsePrefixes() error = nil, want error")
+	}
+}
@@ -0,0 +1,35 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+)
+
+// EmailChannel renders events with the templates and sends them through an
+// EmailNotifier.
+type EmailChannel struct {
+	sender    EmailNotifier
+	templates *Templates
+}
+
+func NewEmailChannel(sender EmailNotifier, templates *Templates) *EmailChannel {
+	return &EmailChannel{sender: sender, templates: templates}
+}
+
+func (c *EmailChannel) Notify(_ context.Context, to Recipient, event Event) error {
+	if to.Email == "" {
+		return ErrNoRecipient
+	}
+
+	msg, err := c.templates.Render(event.Type, to.Locale, event)
+	if err != nil {
+		return fmt.Errorf("render email: %w", err)
+	}
+	msg.To = to.Email
+
+	if err := c.sender.Send(msg); err != nil {
+		return fmt.Errorf("send email: %w", err)
+	}
+
+	return nil
+}
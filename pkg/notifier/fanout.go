@@ -0,0 +1,76 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Channel is a Notifier under the name its deliveries are recorded by.
+type Channel struct {
+	Name     string
+	Notifier Notifier
+	// RevokeURL allows the channel to get the revoke link of events. It
+	// signs the user out, so it is removed from the events of channels that
+	// do not reach the user alone, e.g. a webhook or a shared chat.
+	RevokeURL bool
+}
+
+// FanOut delivers every event to all of its channels. Channels the recipient
+// has no address for are skipped, ErrNoRecipient is returned only when no
+// channel could be used.
+type FanOut struct {
+	channels []Channel
+}
+
+func NewFanOut(channels ...Channel) *FanOut {
+	return &FanOut{channels: channels}
+}
+
+func (f *FanOut) Notify(ctx context.Context, to Recipient, event Event) error {
+	_, err := f.NotifyChannels(ctx, to, event, nil)
+	return err
+}
+
+// NotifyChannels is like Notify but skips the channels named in delivered and
+// returns them together with the channels that succeeded now. A failing
+// channel does not stop the others, so the caller can record the result and
+// retry only the channels that failed.
+func (f *FanOut) NotifyChannels(
+	ctx context.Context,
+	to Recipient,
+	event Event,
+	delivered []string,
+) ([]string, error) {
+	delivered = slices.Clone(delivered)
+
+	var errs []error
+	for _, c := range f.channels {
+		if slices.Contains(delivered, c.Name) {
+			continue
+		}
+
+		channelEvent := event
+		if !c.RevokeURL {
+			channelEvent.RevokeURL = ""
+		}
+
+		err := c.Notifier.Notify(ctx, to, channelEvent)
+		switch {
+		case err == nil:
+			delivered = append(delivered, c.Name)
+		case errors.Is(err, ErrNoRecipient):
+		default:
+			errs = append(errs, fmt.Errorf("%s: %w", c.Name, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return delivered, errors.Join(errs...)
+	}
+	if len(delivered) == 0 {
+		return nil, ErrNoRecipient
+	}
+	return delivered, nil
+}
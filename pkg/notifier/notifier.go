@@ -1,5 +1,56 @@
 package notifier
 
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNoRecipient is returned by a channel when the recipient has no address
+// for it, e.g. a user without a phone number and the SMS channel.
+var ErrNoRecipient = errors.New("recipient has no address for the channel")
+
+// Event is a security event the user is notified about. Its fields are also
+// available to the message templates.
+type Event struct {
+	// ID is the same for every delivery attempt of the event.
+	ID string `json:"id,omitempty"`
+	// Type names the event and the template it is rendered with.
+	Type   string `json:"type"`
+	UserID string `json:"user_id"`
+	OldIP  string `json:"old_ip,omitempty"`
+	// OldLocation and NewLocation are optional, e.g. "DE, AS3320 Deutsche Telekom AG".
+	OldLocation string    `json:"old_location,omitempty"`
+	NewIP       string    `json:"new_ip,omitempty"`
+	NewLocation string    `json:"new_location,omitempty"`
+	UserAgent   string    `json:"user_agent,omitempty"`
+	OccurredAt  time.Time `json:"occurred_at"`
+	// RevokeURL is the "this wasn't me" link, it is empty when not configured
+	// or not allowed for the channel, see Channel.RevokeURL.
+	RevokeURL string `json:"revoke_url,omitempty"`
+}
+
+// Recipient holds the addresses of a user, a channel uses the one it needs.
+type Recipient struct {
+	Email          string
+	Phone          string
+	TelegramChatID string
+	Locale         string
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, to Recipient, event Event) error
+}
+
+type Message struct {
+	To      string
+	Subject string
+	// Text is the plain text body. HTML is optional, when set the message is
+	// sent as multipart/alternative with both bodies.
+	Text string
+	HTML string
+}
+
 type EmailNotifier interface {
-	Send(to, subject, body string) error
+	Send(msg Message) error
 }
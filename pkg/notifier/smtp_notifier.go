@@ -0,0 +1,285 @@
+package notifier
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SMTPSecurityNone     = "none"
+	SMTPSecurityStartTLS = "starttls"
+	SMTPSecurityTLS      = "tls"
+
+	SMTPAuthNone  = "none"
+	SMTPAuthPlain = "plain"
+	SMTPAuthLogin = "login"
+)
+
+var ErrInvalidHeader = errors.New("invalid header value")
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	// Security is one of SMTPSecurityNone, SMTPSecurityStartTLS or SMTPSecurityTLS.
+	Security string
+	// Auth is one of SMTPAuthNone, SMTPAuthPlain or SMTPAuthLogin.
+	Auth string
+	// Timeout bounds the whole SMTP session, including dialing.
+	Timeout time.Duration
+	// TLSConfig is optional, by default the server certificate is verified against Host.
+	TLSConfig *tls.Config
+}
+
+type SMTPEmailNotifier struct {
+	cfg  SMTPConfig
+	from *mail.Address
+}
+
+func NewSMTPEmailNotifier(cfg SMTPConfig) (*SMTPEmailNotifier, error) {
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("parse from address: %w", err)
+	}
+
+	if cfg.TLSConfig == nil {
+		cfg.TLSConfig = &tls.Config{ServerName: cfg.Host, MinVersion: tls.VersionTLS12}
+	}
+
+	return &SMTPEmailNotifier{cfg: cfg, from: from}, nil
+}
+
+func (n *SMTPEmailNotifier) Send(m Message) error {
+	rcpt, err := mail.ParseAddress(m.To)
+	if err != nil {
+		return fmt.Errorf("parse recipient address: %w", err)
+	}
+
+	msg, err := n.buildMessage(rcpt, m)
+	if err != nil {
+		return fmt.Errorf("build message: %w", err)
+	}
+
+	c, err := n.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.Mail(n.from.Address); err != nil {
+		return fmt.Errorf("smtp MAIL: %w", err)
+	}
+	if err := c.Rcpt(rcpt.Address); err != nil {
+		return fmt.Errorf("smtp RCPT: %w", err)
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("close message: %w", err)
+	}
+
+	if err := c.Quit(); err != nil {
+		return fmt.Errorf("smtp QUIT: %w", err)
+	}
+
+	return nil
+}
+
+func (n *SMTPEmailNotifier) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(n.cfg.Host, strconv.Itoa(n.cfg.Port))
+	deadline := time.Now().Add(n.cfg.Timeout)
+
+	dialer := &net.Dialer{Deadline: deadline}
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial smtp server: %w", err)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("set connection deadline: %w", err)
+	}
+
+	if n.cfg.Security == SMTPSecurityTLS {
+		tlsConn := tls.Client(conn, n.cfg.TLSConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("tls handshake: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	c, err := smtp.NewClient(conn, n.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("create smtp client: %w", err)
+	}
+
+	if n.cfg.Security == SMTPSecurityStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			c.Close()
+			return nil, errors.New("smtp server does not support STARTTLS")
+		}
+		if err := c.StartTLS(n.cfg.TLSConfig); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("smtp STARTTLS: %w", err)
+		}
+	}
+
+	if auth := n.auth(); auth != nil {
+		if err := c.Auth(auth); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("smtp AUTH: %w", err)
+		}
+	}
+
+	return c, nil
+}
+
+func (n *SMTPEmailNotifier) auth() smtp.Auth {
+	switch n.cfg.Auth {
+	case SMTPAuthPlain:
+		return smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, n.cfg.Host)
+	case SMTPAuthLogin:
+		return &loginAuth{username: n.cfg.Username, password: n.cfg.Password, host: n.cfg.Host}
+	default:
+		return nil
+	}
+}
+
+func (n *SMTPEmailNotifier) buildMessage(to *mail.Address, m Message) ([]byte, error) {
+	if strings.ContainsAny(m.Subject, "\r\n") {
+		return nil, ErrInvalidHeader
+	}
+
+	var buf bytes.Buffer
+	header := func(key, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+
+	header("From", n.from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", n.messageID())
+	header("MIME-Version", "1.0")
+
+	if m.HTML == "" {
+		header("Content-Type", `text/plain; charset="utf-8"`)
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+
+		if err := writeQuotedPrintable(&buf, m.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	header("Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{
+		"boundary": mw.Boundary(),
+	}))
+	buf.WriteString("\r\n")
+
+	// Clients show the last part they support, so the richer one goes last.
+	parts := []struct{ contentType, body string }{
+		{`text/plain; charset="utf-8"`, m.Text},
+		{`text/html; charset="utf-8"`, m.HTML},
+	}
+	for _, p := range parts {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, p.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func (n *SMTPEmailNotifier) messageID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	domain := n.cfg.Host
+	if _, d, ok := strings.Cut(n.from.Address, "@"); ok {
+		domain = d
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain)
+}
+
+// loginAuth implements the LOGIN mechanism, which net/smtp lacks.
+// Like smtp.PlainAuth it refuses to send credentials over an unencrypted
+// connection to anything but localhost.
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected server challenge %q", fromServer)
+	}
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
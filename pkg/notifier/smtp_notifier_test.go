@@ -0,0 +1,526 @@
+package notifier
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSMTPHost = "127.0.0.1"
+
+// fakeSMTPServer accepts a single SMTP session and records what the client
+// sent. It supports just enough of the protocol for SMTPEmailNotifier.
+type fakeSMTPServer struct {
+	listener net.Listener
+	tls      *tls.Config
+	// implicitTLS wraps the connection in TLS before the greeting.
+	implicitTLS bool
+	// startTLS advertises and accepts STARTTLS.
+	startTLS bool
+	// silent accepts the connection but never greets the client.
+	silent bool
+
+	done chan fakeSMTPSession
+}
+
+type fakeSMTPSession struct {
+	tls      bool
+	authMech string
+	username string
+	password string
+	from     string
+	rcpt     string
+	data     []byte
+	err      error
+}
+
+func newFakeSMTPServer(t *testing.T, opts func(s *fakeSMTPServer)) *fakeSMTPServer {
+	t.Helper()
+
+	l, err := net.Listen("tcp", net.JoinHostPort(testSMTPHost, "0"))
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	s := &fakeSMTPServer{
+		listener: l,
+		tls:      &tls.Config{Certificates: []tls.Certificate{testCertificate(t)}},
+		done:     make(chan fakeSMTPSession, 1),
+	}
+	if opts != nil {
+		opts(s)
+	}
+
+	go s.serve()
+	return s
+}
+
+func (s *fakeSMTPServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTPServer) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		s.done <- fakeSMTPSession{err: err}
+		return
+	}
+	defer conn.Close()
+
+	if s.silent {
+		// Hold the connection open until the client gives up.
+		_, _ = io.Copy(io.Discard, conn)
+		s.done <- fakeSMTPSession{}
+		return
+	}
+
+	var session fakeSMTPSession
+	session.err = s.handle(conn, &session)
+	s.done <- session
+}
+
+func (s *fakeSMTPServer) handle(conn net.Conn, session *fakeSMTPSession) error {
+	if s.implicitTLS {
+		tlsConn := tls.Server(conn, s.tls)
+		if err := tlsConn.Handshake(); err != nil {
+			return err
+		}
+		conn = tlsConn
+		session.tls = true
+	}
+
+	text := textproto.NewConn(conn)
+	if err := text.PrintfLine("220 %s ESMTP fake", testSMTPHost); err != nil {
+		return err
+	}
+
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return err
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			ext := []string{testSMTPHost, "AUTH PLAIN LOGIN"}
+			if s.startTLS && !session.tls {
+				ext = append(ext, "STARTTLS")
+			}
+			for i, e := range ext {
+				sep := "-"
+				if i == len(ext)-1 {
+					sep = " "
+				}
+				if err := text.PrintfLine("250%s%s", sep, e); err != nil {
+					return err
+				}
+			}
+		case "STARTTLS":
+			if err := text.PrintfLine("220 ready"); err != nil {
+				return err
+			}
+			tlsConn := tls.Server(conn, s.tls)
+			if err := tlsConn.Handshake(); err != nil {
+				return err
+			}
+			conn = tlsConn
+			text = textproto.NewConn(conn)
+			session.tls = true
+		case "AUTH":
+			if err := s.auth(text, arg, session); err != nil {
+				return err
+			}
+		case "MAIL":
+			session.from = arg
+			if err := text.PrintfLine("250 ok"); err != nil {
+				return err
+			}
+		case "RCPT":
+			session.rcpt = arg
+			if err := text.PrintfLine("250 ok"); err != nil {
+				return err
+			}
+		case "DATA":
+			if err := text.PrintfLine("354 go ahead"); err != nil {
+				return err
+			}
+			if session.data, err = text.ReadDotBytes(); err != nil {
+				return err
+			}
+			if err := text.PrintfLine("250 queued"); err != nil {
+				return err
+			}
+		case "QUIT":
+			return text.PrintfLine("221 bye")
+		default:
+			if err := text.PrintfLine("502 unsupported"); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *fakeSMTPServer) auth(text *textproto.Conn, arg string, session *fakeSMTPSession) error {
+	mech, initial, _ := strings.Cut(arg, " ")
+	session.authMech = mech
+
+	switch mech {
+	case "PLAIN":
+		b, err := base64.StdEncoding.DecodeString(initial)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(string(b), "\x00")
+		if len(parts) != 3 {
+			return errors.New("malformed PLAIN response")
+		}
+		session.username, session.password = parts[1], parts[2]
+	case "LOGIN":
+		var err error
+		if session.username, err = loginPrompt(text, "Username:"); err != nil {
+			return err
+		}
+		if session.password, err = loginPrompt(text, "Password:"); err != nil {
+			return err
+		}
+	default:
+		return text.PrintfLine("504 unsupported mechanism")
+	}
+
+	return text.PrintfLine("235 authenticated")
+}
+
+func loginPrompt(text *textproto.Conn, prompt string) (string, error) {
+	if err := text.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(prompt))); err != nil {
+		return "", err
+	}
+	line, err := text.ReadLine()
+	if err != nil {
+		return "", err
+	}
+	b, err := base64.StdEncoding.DecodeString(line)
+	return string(b), err
+}
+
+func (s *fakeSMTPServer) session(t *testing.T) fakeSMTPSession {
+	t.Helper()
+
+	select {
+	case session := <-s.done:
+		return session
+	case <-time.After(5 * time.Second):
+		t.Fatal("smtp session did not finish")
+		return fakeSMTPSession{}
+	}
+}
+
+// testCertificate returns a self-signed certificate for testSMTPHost.
+func testCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP(testSMTPHost)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func newTestSMTPNotifier(t *testing.T, s *fakeSMTPServer, security, auth string) *SMTPEmailNotifier {
+	t.Helper()
+
+	cert, err := x509.ParseCertificate(s.tls.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	n, err := NewSMTPEmailNotifier(SMTPConfig{
+		Host:      testSMTPHost,
+		Port:      s.port(),
+		Username:  "user",
+		Password:  "secret",
+		From:      "Auth Service <noreply@example.com>",
+		Security:  security,
+		Auth:      auth,
+		Timeout:   5 * time.Second,
+		TLSConfig: &tls.Config{ServerName: testSMTPHost, RootCAs: roots, MinVersion: tls.VersionTLS12},
+	})
+	if err != nil {
+		t.Fatalf("create notifier: %v", err)
+	}
+	return n
+}
+
+func TestSMTPEmailNotifier_Send(t *testing.T) {
+	tests := []struct {
+		name        string
+		security    string
+		auth        string
+		implicitTLS bool
+		startTLS    bool
+		wantTLS     bool
+		wantMech    string
+	}{
+		{
+			name:     "plain without auth",
+			security: SMTPSecurityNone,
+			auth:     SMTPAuthNone,
+		},
+		{
+			name:     "plain with PLAIN auth to localhost",
+			security: SMTPSecurityNone,
+			auth:     SMTPAuthPlain,
+			wantMech: "PLAIN",
+		},
+		{
+			name:     "starttls with PLAIN auth",
+			security: SMTPSecurityStartTLS,
+			auth:     SMTPAuthPlain,
+			startTLS: true,
+			wantTLS:  true,
+			wantMech: "PLAIN",
+		},
+		{
+			name:     "starttls with LOGIN auth",
+			security: SMTPSecurityStartTLS,
+			auth:     SMTPAuthLogin,
+			startTLS: true,
+			wantTLS:  true,
+			wantMech: "LOGIN",
+		},
+		{
+			name:        "implicit tls with LOGIN auth",
+			security:    SMTPSecurityTLS,
+			auth:        SMTPAuthLogin,
+			implicitTLS: true,
+			wantTLS:     true,
+			wantMech:    "LOGIN",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeSMTPServer(t, func(s *fakeSMTPServer) {
+				s.implicitTLS = tt.implicitTLS
+				s.startTLS = tt.startTLS
+			})
+			n := newTestSMTPNotifier(t, s, tt.security, tt.auth)
+
+			err := n.Send(Message{To: "user@example.com", Subject: "New sign-in", Text: "Hello"})
+			if err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+
+			session := s.session(t)
+			if session.err != nil {
+				t.Fatalf("server error = %v", session.err)
+			}
+			if session.tls != tt.wantTLS {
+				t.Errorf("tls = %v, want %v", session.tls, tt.wantTLS)
+			}
+			if session.authMech != tt.wantMech {
+				t.Errorf("auth mechanism = %q, want %q", session.authMech, tt.wantMech)
+			}
+			if tt.wantMech != "" && (session.username != "user" || session.password != "secret") {
+				t.Errorf("credentials = %q/%q, want user/secret", session.username, session.password)
+			}
+			if session.from != "FROM:<noreply@example.com>" {
+				t.Errorf("MAIL = %q", session.from)
+			}
+			if session.rcpt != "TO:<user@example.com>" {
+				t.Errorf("RCPT = %q", session.rcpt)
+			}
+			if len(session.data) == 0 {
+				t.Error("no message data received")
+			}
+		})
+	}
+}
+
+func TestSMTPEmailNotifier_Send_StartTLSUnsupported(t *testing.T) {
+	s := newFakeSMTPServer(t, nil)
+	n := newTestSMTPNotifier(t, s, SMTPSecurityStartTLS, SMTPAuthPlain)
+
+	err := n.Send(Message{To: "user@example.com", Subject: "New sign-in", Text: "Hello"})
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("Send() error = %v, want STARTTLS error", err)
+	}
+}
+
+func TestSMTPEmailNotifier_Send_Timeout(t *testing.T) {
+	s := newFakeSMTPServer(t, func(s *fakeSMTPServer) { s.silent = true })
+	n := newTestSMTPNotifier(t, s, SMTPSecurityNone, SMTPAuthNone)
+	n.cfg.Timeout = 100 * time.Millisecond
+
+	start := time.Now()
+	err := n.Send(Message{To: "user@example.com", Subject: "New sign-in", Text: "Hello"})
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Send() error = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Send() took %v, want it bounded by the timeout", elapsed)
+	}
+
+	s.session(t)
+}
+
+func TestSMTPEmailNotifier_Send_InvalidSubject(t *testing.T) {
+	n, err := NewSMTPEmailNotifier(SMTPConfig{Host: testSMTPHost, From: "noreply@example.com"})
+	if err != nil {
+		t.Fatalf("create notifier: %v", err)
+	}
+
+	err = n.Send(Message{To: "user@example.com", Subject: "Hi\r\nBcc: evil@example.com", Text: "Hello"})
+	if !errors.Is(err, ErrInvalidHeader) {
+		t.Fatalf("Send() error = %v, want ErrInvalidHeader", err)
+	}
+}
+
+func TestSMTPEmailNotifier_Send_Body(t *testing.T) {
+	tests := []struct {
+		name      string
+		msg       Message
+		wantParts []mailPart
+	}{
+		{
+			name: "text only",
+			msg:  Message{Text: "Привет, new sign-in from 203.0.113.7"},
+			wantParts: []mailPart{
+				{"text/plain", "Привет, new sign-in from 203.0.113.7"},
+			},
+		},
+		{
+			name: "text and html",
+			msg:  Message{Text: "New sign-in", HTML: "<p>New <b>sign-in</b></p>"},
+			wantParts: []mailPart{
+				{"text/plain", "New sign-in"},
+				{"text/html", "<p>New <b>sign-in</b></p>"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeSMTPServer(t, nil)
+			n := newTestSMTPNotifier(t, s, SMTPSecurityNone, SMTPAuthNone)
+
+			tt.msg.To = "user@example.com"
+			tt.msg.Subject = "Новый вход"
+			if err := n.Send(tt.msg); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+
+			session := s.session(t)
+			if session.err != nil {
+				t.Fatalf("server error = %v", session.err)
+			}
+
+			msg, err := mail.ReadMessage(strings.NewReader(string(session.data)))
+			if err != nil {
+				t.Fatalf("read message: %v", err)
+			}
+
+			subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+			if err != nil || subject != tt.msg.Subject {
+				t.Errorf("Subject = %q (%v), want %q", subject, err, tt.msg.Subject)
+			}
+
+			got := readParts(t, msg)
+			if len(got) != len(tt.wantParts) {
+				t.Fatalf("got %d parts, want %d", len(got), len(tt.wantParts))
+			}
+			for i, want := range tt.wantParts {
+				if got[i].contentType != want.contentType || got[i].body != want.body {
+					t.Errorf("part %d = %q %q, want %q %q", i, got[i].contentType, got[i].body, want.contentType, want.body)
+				}
+			}
+		})
+	}
+}
+
+type mailPart struct {
+	contentType string
+	body        string
+}
+
+// readParts returns the decoded bodies of a single part or
+// multipart/alternative message in order.
+func readParts(t *testing.T, msg *mail.Message) []mailPart {
+	t.Helper()
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("parse content type: %v", err)
+	}
+
+	if mediaType != "multipart/alternative" {
+		if enc := msg.Header.Get("Content-Transfer-Encoding"); enc != "quoted-printable" {
+			t.Fatalf("Content-Transfer-Encoding = %q", enc)
+		}
+		body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+		if err != nil {
+			t.Fatalf("read body: %v", err)
+		}
+		// The line break before the terminating dot belongs to the DATA framing.
+		return []mailPart{{mediaType, strings.TrimSuffix(string(body), "\n")}}
+	}
+
+	var parts []mailPart
+	mr := multipart.NewReader(bufio.NewReader(msg.Body), params["boundary"])
+	for {
+		// NextPart decodes quoted-printable parts.
+		p, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return parts
+		}
+		if err != nil {
+			t.Fatalf("next part: %v", err)
+		}
+
+		contentType, _, err := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		if err != nil {
+			t.Fatalf("parse part content type: %v", err)
+		}
+		body, err := io.ReadAll(p)
+		if err != nil {
+			t.Fatalf("read part: %v", err)
+		}
+		parts = append(parts, mailPart{contentType, string(body)})
+	}
+}
@@ -1,11 +1,27 @@
 package notifier
 
+import "context"
+
 type StubEmailNotifier struct{}
 
 func NewStubEmailNotifier() *StubEmailNotifier {
 	return &StubEmailNotifier{}
 }
 
-func (n *StubEmailNotifier) Send(to, subject, body string) error {
+func (n *StubEmailNotifier) Send(msg Message) error {
+	return nil
+}
+
+// StubSMSNotifier stands in for an SMS gateway until one is integrated.
+type StubSMSNotifier struct{}
+
+func NewStubSMSNotifier() *StubSMSNotifier {
+	return &StubSMSNotifier{}
+}
+
+func (n *StubSMSNotifier) Notify(_ context.Context, to Recipient, _ Event) error {
+	if to.Phone == "" {
+		return ErrNoRecipient
+	}
 	return nil
 }
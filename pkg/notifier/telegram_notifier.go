@@ -0,0 +1,97 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const defaultTelegramAPIURL = "https://api.telegram.org"
+
+type TelegramConfig struct {
+	BotToken string
+	// APIURL is optional, by default the public Bot API is used.
+	APIURL string
+	Client *http.Client
+}
+
+// TelegramNotifier sends the plain text rendering of events to the user's
+// chat with the bot.
+type TelegramNotifier struct {
+	cfg       TelegramConfig
+	templates *Templates
+}
+
+func NewTelegramNotifier(cfg TelegramConfig, templates *Templates) *TelegramNotifier {
+	if cfg.APIURL == "" {
+		cfg.APIURL = defaultTelegramAPIURL
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	return &TelegramNotifier{cfg: cfg, templates: templates}
+}
+
+type telegramMessage struct {
+	ChatID            string `json:"chat_id"`
+	Text              string `json:"text"`
+	DisableWebPreview bool   `json:"disable_web_page_preview"`
+}
+
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+}
+
+func (n *TelegramNotifier) Notify(ctx context.Context, to Recipient, event Event) error {
+	if to.TelegramChatID == "" {
+		return ErrNoRecipient
+	}
+
+	msg, err := n.templates.Render(event.Type, to.Locale, event)
+	if err != nil {
+		return fmt.Errorf("render message: %w", err)
+	}
+
+	body, err := json.Marshal(telegramMessage{
+		ChatID:            to.TelegramChatID,
+		Text:              msg.Subject + "\n\n" + msg.Text,
+		DisableWebPreview: true,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal message: %w", err)
+	}
+
+	u := strings.TrimRight(n.cfg.APIURL, "/") + "/bot" + n.cfg.BotToken + "/sendMessage"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.cfg.Client.Do(req)
+	if err != nil {
+		// The URL contains the bot token, keep it out of the error.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result telegramResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("decode response: status %d: %w", resp.StatusCode, err)
+	}
+	if !result.OK {
+		return fmt.Errorf("telegram api: status %d: %s", resp.StatusCode, result.Description)
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package notifier
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+const (
+	textTemplateExt = ".txt.tmpl"
+	htmlTemplateExt = ".html.tmpl"
+	subjectTemplate = "subject"
+)
+
+var ErrTemplateNotFound = errors.New("template not found")
+
+// Templates renders email messages from a file system with one directory per
+// locale:
+//
+//	templates/
+//	├── en/
+//	│   ├── ip_changed.txt.tmpl
+//	│   └── ip_changed.html.tmpl
+//	└── ru/
+//	    └── ...
+//
+// The text template is required and must define a "subject" template, the
+// rest of it is the plain text body. The HTML template is optional.
+type Templates struct {
+	defaultLocale string
+	text          map[string]*texttemplate.Template
+	html          map[string]*htmltemplate.Template
+}
+
+func LoadTemplates(fsys fs.FS, defaultLocale string) (*Templates, error) {
+	t := &Templates{
+		defaultLocale: normalizeLocale(defaultLocale),
+		text:          make(map[string]*texttemplate.Template),
+		html:          make(map[string]*htmltemplate.Template),
+	}
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("read templates dir: %w", err)
+	}
+
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		locale := normalizeLocale(e.Name())
+
+		textFiles, err := fs.Glob(fsys, path.Join(e.Name(), "*"+textTemplateExt))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range textFiles {
+			name := strings.TrimSuffix(path.Base(file), textTemplateExt)
+			tmpl, err := texttemplate.ParseFS(fsys, file)
+			if err != nil {
+				return nil, fmt.Errorf("parse template: %w", err)
+			}
+			if tmpl.Lookup(subjectTemplate) == nil {
+				return nil, fmt.Errorf("template %s does not define %q", file, subjectTemplate)
+			}
+			t.text[templateKey(locale, name)] = tmpl
+		}
+
+		htmlFiles, err := fs.Glob(fsys, path.Join(e.Name(), "*"+htmlTemplateExt))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range htmlFiles {
+			name := strings.TrimSuffix(path.Base(file), htmlTemplateExt)
+			if _, ok := t.text[templateKey(locale, name)]; !ok {
+				return nil, fmt.Errorf("template %s has no %s counterpart", file, textTemplateExt)
+			}
+			tmpl, err := htmltemplate.ParseFS(fsys, file)
+			if err != nil {
+				return nil, fmt.Errorf("parse template: %w", err)
+			}
+			t.html[templateKey(locale, name)] = tmpl
+		}
+	}
+
+	return t, nil
+}
+
+// Render executes the name template for locale and returns a message without
+// a recipient. A regional locale such as "ru-RU" falls back to "ru", and any
+// locale without the template falls back to the default locale.
+func (t *Templates) Render(name, locale string, data any) (Message, error) {
+	key, ok := t.resolve(name, locale)
+	if !ok {
+		return Message{}, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+
+	var subject, text bytes.Buffer
+	tmpl := t.text[key]
+	if err := tmpl.ExecuteTemplate(&subject, subjectTemplate, data); err != nil {
+		return Message{}, fmt.Errorf("execute subject template: %w", err)
+	}
+	if err := tmpl.Execute(&text, data); err != nil {
+		return Message{}, fmt.Errorf("execute text template: %w", err)
+	}
+
+	msg := Message{
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    strings.TrimSpace(text.String()),
+	}
+
+	if tmpl, ok := t.html[key]; ok {
+		var html bytes.Buffer
+		if err := tmpl.Execute(&html, data); err != nil {
+			return Message{}, fmt.Errorf("execute html template: %w", err)
+		}
+		msg.HTML = strings.TrimSpace(html.String())
+	}
+
+	return msg, nil
+}
+
+func (t *Templates) resolve(name, locale string) (string, bool) {
+	locale = normalizeLocale(locale)
+	candidates := []string{locale}
+	if lang, _, ok := strings.Cut(locale, "-"); ok {
+		candidates = append(candidates, lang)
+	}
+	candidates = append(candidates, t.defaultLocale)
+
+	for _, l := range candidates {
+		if _, ok := t.text[templateKey(l, name)]; ok {
+			return templateKey(l, name), true
+		}
+	}
+	return "", false
+}
+
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+}
+
+func templateKey(locale, name string) string {
+	return locale + "/" + name
+}
@@ -0,0 +1,130 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	WebhookIDHeader        = "X-Webhook-Id"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+type WebhookConfig struct {
+	URL string
+	// Secret is the HMAC-SHA256 key the payload is signed with.
+	Secret string
+	// MaxRetries is the number of retries after the first attempt fails with
+	// a network error, 429 or 5xx. Other responses are not retried.
+	MaxRetries int
+	// RetryBackoff is the delay before the first retry, doubled after each one.
+	RetryBackoff time.Duration
+	Client       *http.Client
+}
+
+// WebhookNotifier posts events as JSON. Receivers verify the
+// X-Webhook-Signature header, "sha256=" followed by the hex encoded
+// HMAC-SHA256 of "<X-Webhook-Timestamp>.<body>", and may deduplicate
+// deliveries by X-Webhook-Id, the ID of the event. Retries of a delivery and
+// redeliveries of the event by the caller keep the same X-Webhook-Id.
+type WebhookNotifier struct {
+	cfg WebhookConfig
+}
+
+func NewWebhookNotifier(cfg WebhookConfig) *WebhookNotifier {
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	return &WebhookNotifier{cfg: cfg}
+}
+
+type webhookError struct {
+	err       error
+	retryable bool
+}
+
+func (e *webhookError) Error() string { return e.err.Error() }
+func (e *webhookError) Unwrap() error { return e.err }
+
+func (n *WebhookNotifier) Notify(ctx context.Context, _ Recipient, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+
+	deliveryID := event.ID
+	if deliveryID == "" {
+		deliveryID = uuid.NewString()
+	}
+	backoff := n.cfg.RetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		err := n.post(ctx, deliveryID, body)
+		if err == nil {
+			return nil
+		}
+
+		var werr *webhookError
+		if !errors.As(err, &werr) || !werr.retryable || attempt >= n.cfg.MaxRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (n *WebhookNotifier) post(ctx context.Context, deliveryID string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookIDHeader, deliveryID)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(n.cfg.Secret, timestamp, body))
+
+	resp, err := n.cfg.Client.Do(req)
+	if err != nil {
+		return &webhookError{err: fmt.Errorf("send request: %w", err), retryable: ctx.Err() == nil}
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	return &webhookError{
+		err:       fmt.Errorf("unexpected status %d", resp.StatusCode),
+		retryable: resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500,
+	}
+}
+
+// SignWebhook returns the hex encoded signature of a webhook payload.
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
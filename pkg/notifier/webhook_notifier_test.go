@@ -0,0 +1,158 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeWebhookReceiver answers with the statuses in turn, the last one from
+// then on, and records the requests it got.
+type fakeWebhookReceiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	ids      []string
+	bodies   []map[string]any
+}
+
+func newFakeWebhookReceiver(t *testing.T, statuses ...int) *fakeWebhookReceiver {
+	t.Helper()
+
+	f := &fakeWebhookReceiver{statuses: statuses}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var payload map[string]any
+		_ = json.Unmarshal(body, &payload)
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.ids = append(f.ids, r.Header.Get(WebhookIDHeader))
+		f.bodies = append(f.bodies, payload)
+
+		status := f.statuses[0]
+		if len(f.statuses) > 1 {
+			f.statuses = f.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+func (f *fakeWebhookReceiver) requests() ([]string, []map[string]any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.ids, f.bodies
+}
+
+func TestWebhookNotifier_Retries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		maxRetries   int
+		wantErr      bool
+		wantRequests int
+	}{
+		{
+			name:         "delivered",
+			statuses:     []int{http.StatusNoContent},
+			maxRetries:   3,
+			wantRequests: 1,
+		},
+		{
+			name:         "retried server error",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+			maxRetries:   3,
+			wantRequests: 3,
+		},
+		{
+			name:         "retries exhausted",
+			statuses:     []int{http.StatusInternalServerError},
+			maxRetries:   2,
+			wantErr:      true,
+			wantRequests: 3,
+		},
+		{
+			name:         "client error is not retried",
+			statuses:     []int{http.StatusBadRequest},
+			maxRetries:   3,
+			wantErr:      true,
+			wantRequests: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeWebhookReceiver(t, tt.statuses...)
+			n := NewWebhookNotifier(WebhookConfig{
+				URL:          f.URL,
+				Secret:       "secret",
+				MaxRetries:   tt.maxRetries,
+				RetryBackoff: time.Millisecond,
+			})
+
+			err := n.Notify(context.Background(), Recipient{}, Event{ID: "event-1", Type: "ip_changed"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Notify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			ids, _ := f.requests()
+			if len(ids) != tt.wantRequests {
+				t.Fatalf("requests = %d, want %d", len(ids), tt.wantRequests)
+			}
+			for _, id := range ids {
+				if id != "event-1" {
+					t.Errorf("%s = %q, want the event id", WebhookIDHeader, id)
+				}
+			}
+		})
+	}
+}
+
+func TestFanOut_RevokeURL(t *testing.T) {
+	event := Event{
+		ID:        "event-1",
+		Type:      "ip_changed",
+		RevokeURL: "https://example.com/revoke?token=secret",
+	}
+
+	tests := []struct {
+		name      string
+		revokeURL bool
+		want      any
+	}{
+		{name: "not allowed", revokeURL: false, want: nil},
+		{name: "allowed", revokeURL: true, want: event.RevokeURL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeWebhookReceiver(t, http.StatusOK)
+			fanOut := NewFanOut(Channel{
+				Name:      "webhook",
+				Notifier:  NewWebhookNotifier(WebhookConfig{URL: f.URL, Secret: "secret"}),
+				RevokeURL: tt.revokeURL,
+			})
+
+			if err := fanOut.Notify(context.Background(), Recipient{}, event); err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+
+			_, bodies := f.requests()
+			if len(bodies) != 1 {
+				t.Fatalf("requests = %d, want 1", len(bodies))
+			}
+			if got := bodies[0]["revoke_url"]; got != tt.want {
+				t.Errorf("revoke_url = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,8 @@
+// Package templates holds the default notification email templates, they are
+// embedded into the binary so it runs without the directory.
+package templates
+
+import "embed"
+
+//go:embed */*.tmpl
+var FS embed.FS